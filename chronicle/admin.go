@@ -0,0 +1,184 @@
+package chronicle
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/logging"
+	"github.com/fioprotocol/fio.etl/metrics"
+	"github.com/fioprotocol/fio.etl/transform"
+	"github.com/gorilla/mux"
+)
+
+// Status is a snapshot of what the consumer is doing, served by the admin API.
+type Status struct {
+	Connected   bool                   `json:"connected"`
+	Paused      bool                   `json:"paused"`
+	Interactive bool                   `json:"interactive"`
+	Seen        uint32                 `json:"seen"`
+	Sent        uint32                 `json:"sent"`
+	Acked       uint32                 `json:"acked"`
+	InFlight    int                    `json:"in_flight"`
+	LastMessage time.Time              `json:"last_message"`
+	Queues      map[string]QueueStatus `json:"queues"`
+	AbiAccounts []string               `json:"abi_accounts"`
+}
+
+// QueueStatus counts the records for one output stream
+type QueueStatus struct {
+	Queue     string `json:"queue"`
+	Published uint64 `json:"published"`
+	Errors    uint64 `json:"errors"`
+	// Buffered is the number of records waiting for the producer
+	Buffered int `json:"buffered"`
+}
+
+func (c *Consumer) Status() Status {
+	c.mux.Lock()
+	s := Status{
+		Connected:   connected.get(),
+		Paused:      c.paused(),
+		Interactive: c.Interactive,
+		Seen:        c.Seen,
+		Sent:        c.Sent,
+		Acked:       c.Acked,
+		LastMessage: c.last.UTC(),
+		Queues:      make(map[string]QueueStatus),
+		AbiAccounts: transform.AbiAccounts(),
+	}
+	if c.pipe != nil {
+		s.InFlight = c.pipe.inFlight()
+	}
+	c.mux.Unlock()
+	names := c.cfg.Queues.Map()
+	for name, ch := range c.streams() {
+		s.Queues[name] = QueueStatus{
+			Queue:     names[name],
+			Published: uint64(metrics.Count(metrics.Published.WithLabelValues(name))),
+			Errors:    uint64(metrics.Count(metrics.PublishErrors.WithLabelValues(name))),
+			Buffered:  len(ch),
+		}
+	}
+	return s
+}
+
+// Pause stops reading from chronicle until Resume is called, in-flight messages are still published and acked.
+func (c *Consumer) Pause() {
+	c.pauseMux.Lock()
+	defer c.pauseMux.Unlock()
+	if c.resume == nil {
+		c.resume = make(chan interface{})
+		log.Info("paused reading from chronicle")
+	}
+}
+
+func (c *Consumer) Resume() {
+	c.pauseMux.Lock()
+	defer c.pauseMux.Unlock()
+	if c.resume != nil {
+		close(c.resume)
+		c.resume = nil
+		log.Info("resumed reading from chronicle")
+	}
+}
+
+func (c *Consumer) paused() bool {
+	c.pauseMux.Lock()
+	defer c.pauseMux.Unlock()
+	return c.resume != nil
+}
+
+// waitIfPaused blocks the reader while paused, it returns true if it had to wait.
+func (c *Consumer) waitIfPaused() bool {
+	c.pauseMux.Lock()
+	resume := c.resume
+	c.pauseMux.Unlock()
+	if resume == nil {
+		return false
+	}
+	select {
+	case <-resume:
+	case <-c.ctx.Done():
+	}
+	return true
+}
+
+// Restart ends the chronicle session gracefully, after draining it reports a clean exit on Done so the process can
+// be restarted with a fresh connection.
+func (c *Consumer) Restart() {
+	log.Info("restart requested")
+	if !connected.get() {
+		select {
+		case c.done <- nil:
+		default:
+		}
+		return
+	}
+	stopped.set(true)
+	c.cancel()
+}
+
+// AdminHandler serves the admin API:
+//
+//	GET  /status      consumer status
+//	POST /pause       stop reading from chronicle
+//	POST /resume      resume reading
+//	POST /checkpoint  save the checkpoint now
+//	POST /restart     drain and exit so the process is restarted
+//	GET  /backfill    progress of backfill ranges
+//	POST /backfill    queue a backfill range, interactive mode only
+//	GET  /loglevel    current log level
+//	POST /loglevel    change the log level, with a body like {"level": "debug"}
+func (c *Consumer) AdminHandler() http.Handler {
+	reply := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	ok := map[string]string{"result": "ok"}
+	router := mux.NewRouter()
+	router.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, c.Status())
+	}).Methods(http.MethodGet)
+	router.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		c.Pause()
+		reply(w, http.StatusOK, ok)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		c.Resume()
+		reply(w, http.StatusOK, ok)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		if err := c.save(); err != nil {
+			reply(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		reply(w, http.StatusOK, ok)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/restart", func(w http.ResponseWriter, r *http.Request) {
+		c.Restart()
+		reply(w, http.StatusAccepted, ok)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/backfill", c.BackfillHandler).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			req := struct {
+				Level string `json:"level"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				reply(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			l, err := logging.ParseLevel(req.Level)
+			if err != nil {
+				reply(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			logging.SetLevel(l)
+			log.Info("log level changed", "level", l)
+		}
+		reply(w, http.StatusOK, map[string]string{"level": logging.GetLevel().String()})
+	}).Methods(http.MethodGet, http.MethodPost)
+	return router
+}
@@ -0,0 +1,183 @@
+package chronicle
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BackfillRange is a block range requested from chronicle in interactive mode
+type BackfillRange struct {
+	Id    int    `json:"id"`
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+	// Completed is the number of blocks chronicle has finished sending
+	Completed uint32     `json:"completed"`
+	Done      bool       `json:"done"`
+	Added     time.Time  `json:"added"`
+	Finished  *time.Time `json:"finished,omitempty"`
+
+	// next is the first block that hasn't been requested yet
+	next uint32
+}
+
+// backfill queues ranges to chronicle one chunk at a time, the next chunk is requested once chronicle has completed
+// the last block of the previous one.
+type backfill struct {
+	mux         sync.Mutex
+	ranges      []*BackfillRange
+	current     *BackfillRange
+	chunkStart  uint32
+	chunkEnd    uint32
+	outstanding bool
+	lastId      int
+}
+
+func (b *backfill) add(start uint32, end uint32) (BackfillRange, error) {
+	if start == 0 || start > end {
+		return BackfillRange{}, errors.New("invalid request range")
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.lastId += 1
+	r := &BackfillRange{Id: b.lastId, Start: start, End: end, Added: time.Now().UTC(), next: start}
+	b.ranges = append(b.ranges, r)
+	return *r, nil
+}
+
+// next returns the next chunk to request, ok is false if a chunk is still outstanding or there is nothing left.
+func (b *backfill) next(size uint32) (start uint32, end uint32, ok bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.outstanding {
+		return
+	}
+	for _, r := range b.ranges {
+		if r.next > r.End {
+			continue
+		}
+		start, end = r.next, r.next+size-1
+		if end > r.End || end < start {
+			end = r.End
+		}
+		r.next = end + 1
+		b.current, b.chunkStart, b.chunkEnd, b.outstanding = r, start, end, true
+		return start, end, true
+	}
+	return
+}
+
+// retry puts back the outstanding chunk, for when the request failed or the connection was lost before it completed.
+func (b *backfill) retry() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.outstanding {
+		b.current.next = b.chunkStart
+		b.outstanding = false
+	}
+}
+
+// completed records that chronicle finished sending a block, it returns true once the outstanding chunk is complete.
+func (b *backfill) completed(bn uint32) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if !b.outstanding {
+		return false
+	}
+	if bn >= b.current.Start && bn <= b.current.End && b.current.Completed <= b.current.End-b.current.Start {
+		b.current.Completed += 1
+	}
+	if bn >= b.chunkEnd {
+		b.outstanding = false
+		return true
+	}
+	return false
+}
+
+// confirmed marks ranges done once they have been fully sent and nothing at or below their end is waiting to be
+// published, low is the lowest block with pending records.
+func (b *backfill) confirmed(low uint32, pending bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, r := range b.ranges {
+		if r.Done || r.next <= r.End || (b.outstanding && b.current == r) {
+			continue
+		}
+		if pending && low <= r.End {
+			continue
+		}
+		now := time.Now().UTC()
+		r.Done, r.Finished = true, &now
+		log.Info("backfill complete", "backfill", r.Id, "start", r.Start, "end", r.End)
+	}
+}
+
+func (b *backfill) status() []BackfillRange {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	s := make([]BackfillRange, len(b.ranges))
+	for i := range b.ranges {
+		s[i] = *b.ranges[i]
+	}
+	return s
+}
+
+// requestNext asks chronicle for the next chunk of the backfill queue if nothing is outstanding.
+func (c *Consumer) requestNext() {
+	if !connected.get() || c.ws == nil {
+		return
+	}
+	size := uint32(c.Fetch)
+	if size == 0 {
+		size = 100
+	}
+	start, end, ok := c.backfill.next(size)
+	if !ok {
+		return
+	}
+	if err := c.request(start, end); err != nil {
+		log.Error("requesting blocks", "start", start, "end", end, "error", err)
+		c.backfill.retry()
+		return
+	}
+	log.Debug("requested blocks", "start", start, "end", end)
+}
+
+// BackfillHandler lists the backfill ranges and their progress on GET, and queues a new range on POST with a body
+// like {"start": 1000, "end": 2000}. The consumer must be in interactive mode.
+func (c *Consumer) BackfillHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	reply := func(status int, v interface{}) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	switch r.Method {
+	case http.MethodGet:
+		reply(http.StatusOK, c.backfill.status())
+	case http.MethodPost:
+		if !c.Interactive {
+			reply(http.StatusConflict, map[string]string{"error": "must be interactive to request blocks"})
+			return
+		}
+		req := struct {
+			Start uint32 `json:"start"`
+			End   uint32 `json:"end"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			reply(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		added, err := c.backfill.add(req.Start, req.End)
+		if err != nil {
+			reply(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		log.Info("queued backfill", "backfill", added.Id, "start", added.Start, "end", added.End)
+		c.requestNext()
+		reply(http.StatusAccepted, added)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,49 @@
+package chronicle
+
+import "testing"
+
+func TestBackfill(t *testing.T) {
+	b := &backfill{}
+	if _, err := b.add(20, 10); err == nil {
+		t.Error("expected an error for an inverted range")
+	}
+	r, _ := b.add(10, 34)
+	start, end, ok := b.next(10)
+	if !ok || start != 10 || end != 19 {
+		t.Fatalf("unexpected first chunk %d-%d", start, end)
+	}
+	if _, _, ok = b.next(10); ok {
+		t.Error("only one chunk should be outstanding")
+	}
+	for bn := uint32(10); bn < 19; bn++ {
+		if b.completed(bn) {
+			t.Fatalf("chunk completed early at %d", bn)
+		}
+	}
+	if !b.completed(19) {
+		t.Fatal("chunk should be complete")
+	}
+	b.next(10)
+	b.retry()
+	if start, end, _ = b.next(10); start != 20 || end != 29 {
+		t.Errorf("retry should request 20-29 again, got %d-%d", start, end)
+	}
+	for bn := uint32(20); bn <= 29; bn++ {
+		b.completed(bn)
+	}
+	if start, end, _ = b.next(10); start != 30 || end != 34 {
+		t.Errorf("last chunk should be cut at the end of the range, got %d-%d", start, end)
+	}
+	for bn := uint32(30); bn <= 34; bn++ {
+		b.completed(bn)
+	}
+	b.confirmed(33, true)
+	if b.status()[0].Done {
+		t.Error("range is not done while records are pending")
+	}
+	b.confirmed(0, false)
+	s := b.status()[0]
+	if !s.Done || s.Completed != 25 || s.Id != r.Id {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
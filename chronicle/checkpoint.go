@@ -0,0 +1,61 @@
+package chronicle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// loadCheckpoint restores the consumer's state from file, isNew is true if there was no previous checkpoint.
+func loadCheckpoint(file string, c *Consumer) (isNew bool, err error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading checkpoint %s: %v", file, err)
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return false, fmt.Errorf("checkpoint %s is corrupt, refusing to start (remove it to start over): %v", file, err)
+	}
+	return false, nil
+}
+
+// save writes the checkpoint to a temp file and then renames it, so a crash mid-write can't leave a truncated file.
+func (c *Consumer) save() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	j, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(c.fileName), filepath.Base(c.fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(j)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.fileName)
+}
+
+// checkpoint is a best-effort save used when shutting down.
+func (c *Consumer) checkpoint() {
+	if err := c.save(); err != nil {
+		log.Error("saving checkpoint", "error", err)
+		return
+	}
+	log.Info("saved checkpoint", "acked", c.acknowledged())
+}
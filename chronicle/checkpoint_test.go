@@ -0,0 +1,55 @@
+package chronicle
+
+import (
+	"github.com/fioprotocol/fio.etl/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fioetl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := config.Default()
+	cfg.Checkpoint = filepath.Join(dir, "chronicle.json")
+	file := cfg.Checkpoint
+
+	c, err := NewConsumer(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Fetch != 100 {
+		t.Error("new consumer should use default fetch size")
+	}
+	c.Seen, c.Sent, c.Acked = 1000, 1001, 999
+	c.Interactive = true
+	if err = c.save(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Error("temp file was left behind")
+	}
+
+	restored, err := NewConsumer(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Seen != 1000 || restored.Sent != 1001 || restored.Acked != 999 {
+		t.Errorf("checkpoint not restored: %+v", restored)
+	}
+	if restored.Interactive {
+		t.Error("interactive mode should come from the config, not the checkpoint")
+	}
+
+	if err = ioutil.WriteFile(file, []byte(`{"confirmed": 10`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewConsumer(cfg, nil); err == nil {
+		t.Error("expected an error loading a corrupt checkpoint")
+	}
+}
@@ -5,34 +5,58 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/fioprotocol/fio.etl/config"
+	"github.com/fioprotocol/fio.etl/deadletter"
+	"github.com/fioprotocol/fio.etl/metrics"
 	"github.com/fioprotocol/fio.etl/queue"
+	"github.com/fioprotocol/fio.etl/recording"
 	"github.com/fioprotocol/fio.etl/transform"
 	"github.com/sasha-s/go-deadlock"
-	"golang.org/x/text/language"
-	"golang.org/x/text/message"
-	"io/ioutil"
 	"net/http"
-	"os"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 var (
-	connected, stopped bool
-	firstAck  bool = true
+	connected, stopped flag
 )
 
+// flag is a bool shared between the chronicle session's goroutines and the admin and health handlers
+type flag int32
+
+func (f *flag) get() bool {
+	return atomic.LoadInt32((*int32)(f)) == 1
+}
+
+func (f *flag) set(v bool) {
+	var i int32
+	if v {
+		i = 1
+	}
+	atomic.StoreInt32((*int32)(f), i)
+}
+
+// claim sets the flag, it returns false if it was already set.
+func (f *flag) claim() bool {
+	return atomic.CompareAndSwapInt32((*int32)(f), 0, 1)
+}
+
 type Consumer struct {
 	Seen        uint32 `json:"confirmed"`
 	Sent        uint32 `json:"sent"`
 	Fetch       int    `json:"fetch"`
-	Interactive bool   `json:"interactive"`
+	Interactive bool   `json:"-"`
+	Acked       uint32 `json:"acked"`
 
-	fileName string
+	fileName   string
+	cfg        *config.Config
+	sink       queue.Factory
+	publishers map[string]queue.Publisher
 
 	w    http.ResponseWriter
 	r    *http.Request
@@ -40,126 +64,156 @@ type Consumer struct {
 	last time.Time
 	mux  deadlock.Mutex
 	wg   sync.WaitGroup
+	// wsMux serializes writes to the websocket, acks and block requests come from different goroutines
+	wsMux deadlock.Mutex
 
 	ctx       context.Context
 	cancel    func()
 	errs      chan error
-	miscChan  chan []byte
-	blockChan chan []byte
-	txChan    chan []byte
-	rowChan   chan []byte
+	miscChan  chan *queue.Message
+	blockChan chan *queue.Message
+	txChan    chan *queue.Message
+	// quit holds the channel each stream's producer closes when it stops, producing is cancelled once the producers
+	// are being closed. Both are set for each chronicle session before anything is handed to the producers.
+	quit      map[chan *queue.Message]chan interface{}
+	producing context.Context
+	rowChan   chan *queue.Message
+	xferChan  chan *queue.Message
+	tracker   *tracker
+	backfill  *backfill
+	dead      deadletter.Writer
+	pipe      *pipeline
+	recorder  *recording.Writer
+	// recorded is the block messages without a block number are recorded under
+	recorded uint32
+
+	pauseMux sync.Mutex
+	// resume is closed to wake the reader, it is nil unless paused
+	resume chan interface{}
+
+	producers sync.WaitGroup
+	failOnce  sync.Once
+	failErr   error
+	exitDelay time.Duration
+	done      chan error
 }
 
-func NewConsumer(file string) *Consumer {
-	consumer := &Consumer{}
-	var isNew bool
-	if file == "" {
-		file = "chronicle.json"
+// NewConsumer builds a consumer that publishes using sink, restoring its position from the checkpoint file if
+// present. A checkpoint that exists but can't be read is an error: starting over would replay (or skip) data without
+// anybody noticing.
+func NewConsumer(cfg *config.Config, sink queue.Factory) (*Consumer, error) {
+	consumer := &Consumer{cfg: cfg, sink: sink}
+	file := cfg.Checkpoint
+	isNew, err := loadCheckpoint(file, consumer)
+	if err != nil {
+		return nil, err
 	}
-	func() {
-		if f, err := os.OpenFile(file, os.O_RDONLY, 0644); err == nil {
-			defer f.Close()
-			b, err := ioutil.ReadAll(f)
-			if err != nil {
-				elog.Println(err)
-				isNew = true
-				return
-			}
-			err = json.Unmarshal(b, consumer)
-			if err != nil {
-				isNew = true
-				return
-			}
-		}
-	}()
 	if isNew {
 		consumer.Fetch = 100
-		consumer.last = time.Now()
 	}
+	// the mode comes from the configuration only, a checkpoint written in interactive mode must not keep it on
+	consumer.Interactive = cfg.Interactive
+	consumer.last = time.Now()
 	consumer.ctx, consumer.cancel = context.WithCancel(context.Background())
-	consumer.errs = make(chan error)
-	consumer.txChan = make(chan []byte, 1)
-	consumer.rowChan = make(chan []byte, 1)
-	consumer.miscChan = make(chan []byte, 1)
-	consumer.blockChan = make(chan []byte, 1)
+	consumer.errs = make(chan error, 8)
+	consumer.done = make(chan error, 1)
+	consumer.txChan = make(chan *queue.Message, 1)
+	consumer.rowChan = make(chan *queue.Message, 1)
+	consumer.miscChan = make(chan *queue.Message, 1)
+	consumer.blockChan = make(chan *queue.Message, 1)
+	consumer.xferChan = make(chan *queue.Message, 1)
+	consumer.tracker = newTracker()
+	consumer.backfill = &backfill{}
+	if cfg.DeadLetter.File != "" && cfg.DeadLetter.Queue == "" {
+		consumer.dead = deadletter.NewFile(cfg.DeadLetter.File)
+	}
 	consumer.fileName = file
-	return consumer
+	return consumer, nil
 }
 
 func (c *Consumer) Handler(w http.ResponseWriter, r *http.Request) {
 	c.w, c.r = w, r
-	if connected {
+	if !connected.claim() {
 		c.err()
 		return
 	}
-	connected = true
-	defer func() {
-		connected = false
-	}()
+	defer connected.set(false)
+	if c.cfg.Record != "" {
+		var err error
+		if c.recorder, err = recording.Create(c.cfg.Record); err != nil {
+			log.Error("opening recording", "file", c.cfg.Record, "error", err)
+			c.err()
+			return
+		}
+		// finish closes the recording once the session has run, this only covers failing to start one.
+		defer c.recorder.Close()
+	}
+	err := c.connectPublishers()
+	if err != nil {
+		log.Error("connecting publishers", "error", err)
+		c.err()
+		return
+	}
+	// chronicle resends everything after the last acknowledged block, blocks seen since then were never confirmed.
+	c.mux.Lock()
+	if !c.Interactive {
+		c.Seen, c.Sent = c.Acked, c.Acked
+	}
+	c.mux.Unlock()
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize: 8192,
 		CheckOrigin: func(r *http.Request) bool {
 			return true
 		},
 	}
-	var err error
 	c.ws, err = upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		c.err()
 		return
 	}
 	defer c.ws.Close()
-	ilog.Println("connected")
+	log.Info("chronicle connected")
+	if c.Interactive {
+		// anything requested from a previous connection has to be asked for again.
+		c.backfill.retry()
+		c.requestNext()
+	}
 	go func() {
-		e := <-c.errs
-		c.cancel()
-		dlog.Println("delaying 30s exit on err to allow rate limiting to cool off")
-		elog.Println(e)
-		time.Sleep(30 * time.Second)
-		os.Exit(1)
+		select {
+		case <-c.ctx.Done():
+		case e := <-c.errs:
+			log.Debug("delaying 30s exit on err to allow rate limiting to cool off", "error", e)
+			c.exitDelay = 30 * time.Second
+			c.fail(e)
+		}
 	}()
 
-	blockQuit := make(chan interface{})
-	txQuit := make(chan interface{})
-	rowQuit := make(chan interface{})
-	miscQuit := make(chan interface{})
 	pCtx, pClose := context.WithCancel(context.Background())
-	go queue.StartProducer(pCtx, "block", c.blockChan, c.errs, blockQuit)
-	go queue.StartProducer(pCtx, "tx", c.txChan, c.errs, txQuit)
-	go queue.StartProducer(pCtx, "row", c.rowChan, c.errs, rowQuit)
-	go queue.StartProducer(pCtx, "misc", c.miscChan, c.errs, miscQuit)
-
-	panicked := func() {
-		stopped = true
-		pClose()
-		c.cancel()
-		time.Sleep(2 * time.Second)
-		os.Exit(1)
-	}
-
-	go func() {
-		for {
+	c.producing = pCtx
+	c.quit = make(map[chan *queue.Message]chan interface{})
+	for name, ch := range c.streams() {
+		quit := make(chan interface{})
+		c.quit[ch] = quit
+		c.producers.Add(1)
+		go func(name string, ch chan *queue.Message) {
+			defer c.producers.Done()
+			queue.StartProducer(pCtx, c.publishers[name], name, ch, c.errs, quit)
+		}(name, ch)
+		// a producer quitting before the consumer is done can't be recovered from.
+		go func(name string) {
 			select {
 			case <-c.ctx.Done():
-				return
-			case <-blockQuit:
-				panicked()
-			case <-txQuit:
-				panicked()
-			case <-rowQuit:
-				panicked()
-			case <-miscQuit:
-				panicked()
+			case <-quit:
+				c.fail(fmt.Errorf("%s producer quit", name))
 			}
-		}
-	}()
+		}(name)
+	}
+
 	err = c.consume()
-	exitCode := 0
 	if err != nil {
-		exitCode = 1
-		elog.Println(err)
+		log.Error("chronicle session ended", "error", err)
 	}
-	os.Exit(exitCode)
+	c.finish(err, pClose)
 }
 
 type msgSummary struct {
@@ -171,53 +225,48 @@ type msgSummary struct {
 }
 
 func (c *Consumer) consume() error {
-	alive := time.NewTicker(time.Minute)
-	p := message.NewPrinter(language.AmericanEnglish)
+	idle := c.cfg.Limits.IdleTimeout
+	alive := time.NewTicker(idle)
 	var size uint64
 	var t int
-	var a, d []byte
+	var d []byte
 	var e error
 	var fin transform.BlockFinished
-	// deleteme debug:
-	var currentMsgs int
-	counterChan := make(chan int)
 
+	fallback := c.cfg.FallbackUrl
+	pipe := c.pipeline(fallback)
+	c.mux.Lock()
+	c.pipe = pipe
+	c.mux.Unlock()
 	waitForQueue := func() {
-		ilog.Println("waiting up to 180s for queue to empty")
+		log.Info("waiting up to 180s for queue to empty")
 		go func() {
 			time.Sleep(180 * time.Second)
 			c.cancel()
 		}()
-		for currentMsgs > 0 {
+		for pipe.inFlight() > 0 {
 			time.Sleep(100 * time.Millisecond)
 		}
 	}
 
 	sizes := make(chan uint64)
-	wgMux := deadlock.Mutex{}
-	wgAdd := func(i int) {
-		wgMux.Lock()
-		c.wg.Add(i)
-		wgMux.Unlock()
-	}
-	wgDone := func() {
-		wgMux.Lock()
-		c.wg.Done()
-		wgMux.Unlock()
-	}
-	fallback := "http://" + os.Getenv("HOST") + ":" + os.Getenv("FALLBACK_PORT")
+	// the reader is the only goroutine that adds to c.wg, it has to have returned before waiting on it
+	reading := make(chan interface{})
 	go func() {
+		defer close(reading)
 		for {
-			if stopped {
+			if stopped.get() {
 				return
 			}
-			for currentMsgs > 256 {
-				dlog.Println("paused.")
-				time.Sleep(2 * time.Second)
+			if c.waitIfPaused() {
+				// the read deadline will have passed while paused
+				c.touch()
+				_ = c.ws.SetReadDeadline(time.Now().Add(idle))
+				continue
 			}
 			t, d, e = c.ws.ReadMessage()
 			if e != nil {
-				elog.Println(e)
+				log.Error("reading from chronicle", "error", e)
 				_ = c.ws.Close()
 				waitForQueue()
 				c.cancel()
@@ -226,98 +275,68 @@ func (c *Consumer) consume() error {
 			if t != websocket.BinaryMessage {
 				continue
 			}
-			c.last = time.Now()
+			c.touch()
 			s := &msgSummary{}
 			e = json.Unmarshal(d, s)
+			c.record(s.Data.BlockNum, d)
 			if e != nil {
-				elog.Println(e)
+				log.Error("decoding message", "error", e)
+				c.deadLetter(deadletter.New("", 0, d, e))
+				continue
+			}
+			select {
+			case sizes <- uint64(len(d)):
+			case <-c.ctx.Done():
+			}
+			metrics.Received.WithLabelValues(s.Msgtype).Inc()
+			_ = c.ws.SetReadDeadline(time.Now().Add(idle))
+			// a fork always refers to a block we have already seen, so it has to be handled before the stale check.
+			if s.Msgtype == "FORK" {
+				if e = c.fork(d); e != nil {
+					log.Error("handling fork", "error", e)
+				}
 				continue
 			}
-			sizes <- uint64(len(d))
-			_ = c.ws.SetReadDeadline(time.Now().Add(time.Minute))
 			bn, _ := strconv.Atoi(s.Data.BlockNum)
 			// don't resend stale data ... this can happen when chronicle is out of sync with fioetl, and
 			// will result in over-writing records in elasticsearch, consuming space until indices are compacted.
-			if uint32(bn) <= c.Seen {
+			// only acknowledged blocks are stale, anything after them was never confirmed by the sink.
+			// in interactive mode old blocks are exactly what was asked for.
+			if !c.Interactive && uint32(bn) <= c.acknowledged() {
 				continue
 			}
-			switch s.Msgtype {
-			case "ENCODER_ERROR", "RCVR_PAUSE", "FORK":
+			if pipe.handles(s.Msgtype) {
+				// blocks while the pipeline is full
+				pipe.submit(s.Msgtype, uint32(bn), d)
+				d = nil
 				continue
-			case "TBL_ROW":
-				wgAdd(1)
-				go func(d []byte) {
-					counterChan <- 1
-					defer wgDone()
-					a, e := transform.Table(d)
-					if e != nil {
-						elog.Println("process row:", e)
-						counterChan <- -1
-						return
-					}
-					c.rowChan <- a
-					counterChan <- -1
-				}(d)
-			case "BLOCK":
-				wgAdd(1)
-				go func(data []byte) {
-					counterChan <- 1
-					defer wgDone()
-					a, b, e := transform.Block(data, fallback)
-					if e != nil {
-						elog.Println(e)
-					}
-					if a != nil {
-						c.blockChan <- a
-					}
-					if b != nil {
-						c.blockChan <- b
-					}
-					counterChan <- -1
-				}(d)
+			}
+			switch s.Msgtype {
 			case "BLOCK_COMPLETED":
 				e = json.Unmarshal(d, &fin)
 				if e == nil && fin.Data.BlockNum != "" {
 					var fb int
 					fb, e = strconv.Atoi(fin.Data.BlockNum)
-					if e == nil {
+					if e == nil && c.Interactive {
+						if c.backfill.completed(uint32(fb)) {
+							c.requestNext()
+						}
+					} else if e == nil {
+						c.mux.Lock()
 						c.Sent = uint32(fb)
+						c.mux.Unlock()
+						metrics.SentBlock.Set(float64(fb))
 					}
-				}
-			case "PERMISSION", "PERMISSION_LINK", "ACC_METADATA":
-				wgAdd(1)
-				go func(data []byte, s *msgSummary) {
-					counterChan <- 1
-					defer wgDone()
-					a, e := transform.Account(data, s.Msgtype)
-					if e != nil || a == nil {
-						counterChan <- -1
-						return
+					if head, e := strconv.Atoi(fin.Data.Head); e == nil && head >= fb {
+						metrics.HeadBlock.Set(float64(head))
+						metrics.BlockLag.Set(float64(head - fb))
 					}
-					c.miscChan <- a
-					counterChan <- -1
-				}(d, s)
-			case "ABI_UPD":
-				// we'll want this one to block for abi updates:
-				a, e = transform.Abi(d)
-				if e != nil {
-					elog.Println(e)
-					continue
 				}
-				c.miscChan <- a
-			case "TX_TRACE":
-				wgAdd(1)
-				go func(data []byte) {
-					counterChan <- 1
-					defer wgDone()
-					a, e := transform.Trace(data)
-					if e != nil || a == nil {
-						counterChan <- -1
-						return
-					}
-					c.txChan <- a
-					counterChan <- -1
-				}(d)
+			case "ABI_UPD":
+				// abi updates are transformed here rather than in a pool, so later messages are decoded with them.
+				abi := &task{msgtype: s.Msgtype, bn: uint32(bn), data: d}
+				c.transform(abi, fallback)
+				pipe.emit(abi.bn, abi.out...)
 			}
 			d = nil
 		}
@@ -332,23 +351,31 @@ func (c *Consumer) consume() error {
 			case <-c.ctx.Done():
 				return
 			case <-printStat.C:
-				dlog.Println(p.Sprintf("Block: %d, processed %d MiB", c.Seen, size/1024/1024))
-				if currentMsgs > 0 {
-					dlog.Println(p.Sprintf("%d  routines are waiting for buffer", currentMsgs))
-				}
+				c.mux.Lock()
+				seen := c.Seen
+				c.mux.Unlock()
+				log.Debug("progress", "block_num", seen, "processed_mib", size/1024/1024, "in_flight", pipe.inFlight())
 			case s := <-sizes:
 				size += s
-			case m := <-counterChan:
-				currentMsgs += m
+				metrics.BytesProcessed.Add(float64(s))
 			case <-c.ctx.Done():
 				return
 			case <-t.C:
+				c.mux.Lock()
 				if c.Sent > c.Seen {
 					c.Seen = c.Sent
-					err = c.ack()
-					if err != nil {
-						elog.Println(err)
-					}
+					metrics.SeenBlock.Set(float64(c.Seen))
+				}
+				c.mux.Unlock()
+				if c.Interactive {
+					// chronicle isn't acked in interactive mode, only the progress of requested ranges is tracked.
+					c.backfill.confirmed(c.tracker.lowest())
+					continue
+				}
+				// confirms arrive after the block has been seen, so the ack can advance without any new blocks.
+				err = c.ack()
+				if err != nil {
+					log.Error("acknowledging blocks", "error", err)
 				}
 			}
 		}
@@ -359,28 +386,32 @@ func (c *Consumer) consume() error {
 	for {
 		select {
 		case <-c.ctx.Done():
-			stopped = true
-			ilog.Println("consumer cleaning up")
+			stopped.set(true)
+			log.Info("consumer cleaning up")
+			_ = c.ws.SetReadDeadline(time.Now().Add(-1 * time.Second))
+			<-reading
 			c.wg.Wait()
-			ilog.Println("consumer exiting")
+			log.Info("consumer exiting")
 			runtime.GC()
-			_ = c.ws.SetReadDeadline(time.Now().Add(-1 * time.Second))
+			if finalErr == nil {
+				finalErr = c.failErr
+			}
 			return finalErr
 		case <-alive.C:
-			// check if we aren't getting messages
-			if c.last.Before(time.Now().Add(-1*time.Minute)) && currentMsgs == 0 {
+			// check if we aren't getting messages, in interactive mode chronicle is quiet until blocks are requested.
+			if !c.Interactive && !c.paused() && c.idleFor() > idle && pipe.inFlight() == 0 {
 				_ = c.ws.SetReadDeadline(time.Now().Add(-1 * time.Second))
 				waitForQueue()
 				c.cancel()
-				finalErr = errors.New("no data for > 1 minute, closing")
+				finalErr = fmt.Errorf("no data for > %v, closing", idle)
 			}
-			// if we are taking more than 4gb of RAM, we should probably restart.
+			// if we are taking more than the heap limit, we should probably restart.
 			runtime.ReadMemStats(memStats)
-			if memStats.HeapInuse > 4*1024*1024*1024 {
-				stopped = true
-				elog.Println("Exceeded 4gb heap, clearing existing queue")
+			if memStats.HeapInuse > c.cfg.Limits.HeapLimitMiB*1024*1024 {
+				stopped.set(true)
+				log.Error("exceeded heap limit, clearing existing queue", "heap_limit_mib", c.cfg.Limits.HeapLimitMiB)
 				waitForQueue()
-				ilog.Println("cleared queue, restarting.")
+				log.Info("cleared queue, restarting")
 				c.cancel()
 				_ = c.ws.SetReadDeadline(time.Now().Add(-1 * time.Second))
 			}
@@ -388,37 +419,118 @@ func (c *Consumer) consume() error {
 	}
 }
 
-func (c *Consumer) err() {
-	c.r.Body.Close()
-	c.w.WriteHeader(500)
+// pipeline sets up a worker pool for each type of message that is transformed concurrently
+func (c *Consumer) pipeline(fallback string) *pipeline {
+	workers := c.cfg.Limits.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	pipe := newPipeline(c.tracker, &c.wg, c.cfg.Limits.MaxInFlight, c.handOff)
+	transform := func(t *task) {
+		c.transform(t, fallback)
+	}
+	pipe.addPool(workers, transform, "TBL_ROW")
+	pipe.addPool(workers, transform, "BLOCK")
+	pipe.addPool(workers, transform, "PERMISSION", "PERMISSION_LINK", "ACC_METADATA")
+	pipe.addPool(workers, transform, "TX_TRACE")
+	return pipe
 }
 
-func (c *Consumer) save() error {
-	f, err := os.OpenFile(c.fileName, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+// connectPublishers opens a publisher for each of the output streams
+func (c *Consumer) connectPublishers() error {
+	if c.sink == nil {
+		return errors.New("no output sink configured")
 	}
-	defer f.Close()
-	j, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return err
+	publishers := make(map[string]queue.Publisher)
+	for name, q := range c.cfg.Queues.Map() {
+		p, err := c.sink(q)
+		if err != nil {
+			for _, opened := range publishers {
+				_ = opened.Close()
+			}
+			return err
+		}
+		publishers[name] = p
 	}
-	_, err = f.Write(j)
-	return err
+	if q := c.cfg.DeadLetter.Queue; q != "" {
+		p, err := c.sink(q)
+		if err != nil {
+			for _, opened := range publishers {
+				_ = opened.Close()
+			}
+			return err
+		}
+		c.dead = deadletter.NewQueue(p)
+	}
+	c.mux.Lock()
+	c.publishers = publishers
+	c.mux.Unlock()
+	return nil
+}
+
+// record adds a message to the recording if one is configured
+func (c *Consumer) record(blockNum string, d []byte) {
+	if c.recorder == nil {
+		return
+	}
+	if bn, err := strconv.Atoi(blockNum); err == nil {
+		c.recorded = uint32(bn)
+	}
+	if err := c.recorder.Write(c.recorded, d); err != nil {
+		log.Error("recording message", "file", c.cfg.Record, "error", err)
+	}
+}
+
+// touch records that a message just arrived from chronicle
+func (c *Consumer) touch() {
+	c.mux.Lock()
+	c.last = time.Now()
+	c.mux.Unlock()
 }
 
+// idleFor is how long it has been since the last message from chronicle
+func (c *Consumer) idleFor() time.Duration {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return time.Since(c.last)
+}
+
+func (c *Consumer) acknowledged() uint32 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.Acked
+}
+
+func (c *Consumer) err() {
+	c.r.Body.Close()
+	c.w.WriteHeader(500)
+}
+
+// ack tells chronicle the highest block that is completely handled: every block up to it has been received, all of
+// its transforms have finished, and every record published from them has been confirmed.
 func (c *Consumer) ack() error {
-	// always return -256 of what has been seen, this is the max number of blocked routines allowed.
-	if c.Seen <= 256 {
+	// the lock is held until Acked is updated, so a fork can't rewind it in between
+	c.mux.Lock()
+	acked := c.Sent
+	if low, ok := c.tracker.lowest(); ok && low <= acked {
+		acked = low - 1
+	}
+	if acked <= c.Acked {
+		c.mux.Unlock()
 		return nil
 	}
-	seen := c.Seen - 256
-	// prevent chronicle error where first ack is lower than actual, causing a panic.
-	if firstAck {
-		firstAck = false
-		seen += 256
+	c.wsMux.Lock()
+	err := c.ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d", acked)))
+	c.wsMux.Unlock()
+	if err == nil {
+		c.Acked = acked
+	}
+	c.mux.Unlock()
+	if err != nil {
+		return err
 	}
-	return c.ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d", seen)))
+	metrics.AckedBlock.Set(float64(acked))
+	return c.save()
 }
 
 func (c *Consumer) request(start uint32, end uint32) error {
@@ -428,5 +540,7 @@ func (c *Consumer) request(start uint32, end uint32) error {
 	if start > end {
 		return errors.New("invalid request range")
 	}
+	c.wsMux.Lock()
+	defer c.wsMux.Unlock()
 	return c.ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d-%d", start, end)))
 }
@@ -0,0 +1,224 @@
+package chronicle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/config"
+	"github.com/fioprotocol/fio.etl/queue"
+	"github.com/gorilla/websocket"
+)
+
+// confirmingPublisher confirms every message as soon as it is published
+type confirmingPublisher struct {
+	mux    sync.Mutex
+	blocks []uint32
+}
+
+func (p *confirmingPublisher) Publish(msg *queue.Message) error {
+	p.mux.Lock()
+	p.blocks = append(p.blocks, msg.BlockNum)
+	p.mux.Unlock()
+	msg.Confirm(nil)
+	return nil
+}
+func (p *confirmingPublisher) Flush() error  { return nil }
+func (p *confirmingPublisher) Close() error  { return nil }
+func (p *confirmingPublisher) Health() error { return nil }
+
+func (p *confirmingPublisher) published() []uint32 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]uint32{}, p.blocks...)
+}
+
+// failingPublisher rejects every record
+type failingPublisher struct{}
+
+func (p *failingPublisher) Publish(msg *queue.Message) error { return errors.New("sink is down") }
+func (p *failingPublisher) Flush() error                     { return nil }
+func (p *failingPublisher) Close() error                     { return nil }
+func (p *failingPublisher) Health() error                    { return errors.New("sink is down") }
+
+// givingUpPublisher fails on its own, like a rabbitmq publisher once the reconnect deadline passes
+type givingUpPublisher struct {
+	confirmingPublisher
+	failed chan interface{}
+}
+
+func (p *givingUpPublisher) Failed() <-chan interface{} { return p.failed }
+func (p *givingUpPublisher) Health() error              { return errors.New("could not reconnect") }
+
+// testConfig uses a temporary directory for the checkpoint, which end removes
+func testConfig(t *testing.T) (cfg *config.Config, end func()) {
+	dir, err := ioutil.TempDir("", "fioetl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = config.Default()
+	cfg.Checkpoint = filepath.Join(dir, "chronicle.json")
+	cfg.DeadLetter.File = ""
+	return cfg, func() { os.RemoveAll(dir) }
+}
+
+// connect starts a chronicle session with c, end waits for the session's handler to return.
+func connect(t *testing.T, c *Consumer) (ws *websocket.Conn, end func()) {
+	// the handler resets the package state as it returns, the next test mustn't start before it has
+	var handler sync.WaitGroup
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Add(1)
+		defer handler.Done()
+		c.Handler(w, r)
+	}))
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return ws, func() {
+		ws.Close()
+		returned := make(chan interface{})
+		go func() {
+			handler.Wait()
+			close(returned)
+		}()
+		select {
+		case <-returned:
+			srv.Close()
+		case <-time.After(10 * time.Second):
+			t.Error("chronicle session handler did not return")
+		}
+		stopped.set(false)
+	}
+}
+
+func tableRow(bn int) []byte {
+	return []byte(fmt.Sprintf(`{"msgtype":"TBL_ROW","data":{"block_num":"%d","added":"true","kvo":{"code":"example",`+
+		`"scope":"example","table":"things","primary_key":"1","value":{"id":"1"}}}}`, bn))
+}
+
+// TestResendAfterRestart restarts from a checkpoint where blocks were seen but never acknowledged, chronicle resends
+// them and they have to be published again.
+func TestResendAfterRestart(t *testing.T) {
+	cfg, cleanup := testConfig(t)
+	defer cleanup()
+	err := ioutil.WriteFile(cfg.Checkpoint, []byte(`{"confirmed": 100, "sent": 100, "acked": 90, "fetch": 100}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := &confirmingPublisher{}
+	sink := func(q string) (queue.Publisher, error) {
+		if q == cfg.Queues.Row {
+			return rows, nil
+		}
+		return &confirmingPublisher{}, nil
+	}
+	c, err := NewConsumer(cfg, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, end := connect(t, c)
+	defer end()
+
+	for _, msg := range [][]byte{
+		tableRow(95),
+		[]byte(`{"msgtype":"BLOCK_COMPLETED","data":{"block_num":"95","head":"200","last_irreversible":"150"}}`),
+	} {
+		if err = ws.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, ack, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal("waiting for ack:", err)
+	}
+	if string(ack) != "95" {
+		t.Errorf("expected block 95 to be acknowledged, got %s", ack)
+	}
+	if got := rows.published(); len(got) != 1 || got[0] != 95 {
+		t.Errorf("expected the resent row for block 95 to be published, got %v", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = c.Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestFailedPublisherEndsSession fills the pipeline with records for a publisher that has failed, the session still
+// has to end so a supervisor can restart fioetl.
+func TestFailedPublisherEndsSession(t *testing.T) {
+	cfg, cleanup := testConfig(t)
+	defer cleanup()
+	cfg.Limits.Workers = 1
+	cfg.Limits.MaxInFlight = 4
+	sink := func(q string) (queue.Publisher, error) {
+		if q == cfg.Queues.Row {
+			return &failingPublisher{}, nil
+		}
+		return &confirmingPublisher{}, nil
+	}
+	c, err := NewConsumer(cfg, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, end := connect(t, c)
+	defer end()
+
+	for bn := 1; bn <= 20; bn++ {
+		// the consumer stops reading once the producer has quit
+		if ws.WriteMessage(websocket.BinaryMessage, tableRow(bn)) != nil {
+			break
+		}
+	}
+	select {
+	case err = <-c.Done():
+		if err == nil {
+			t.Error("expected the session to end with an error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("session did not end after the row producer failed")
+	}
+}
+
+// TestPublisherGivesUpEndsSession has a publisher give up while nothing is being published, the session still has to
+// end so fioetl exits and a supervisor can restart it.
+func TestPublisherGivesUpEndsSession(t *testing.T) {
+	cfg, cleanup := testConfig(t)
+	defer cleanup()
+	rows := &givingUpPublisher{failed: make(chan interface{})}
+	sink := func(q string) (queue.Publisher, error) {
+		if q == cfg.Queues.Row {
+			return rows, nil
+		}
+		return &confirmingPublisher{}, nil
+	}
+	c, err := NewConsumer(cfg, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, end := connect(t, c)
+	defer end()
+
+	time.AfterFunc(100*time.Millisecond, func() { close(rows.failed) })
+	select {
+	case err = <-c.Done():
+		if err == nil {
+			t.Error("expected the session to end with an error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("session did not end after the publisher gave up")
+	}
+}
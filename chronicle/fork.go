@@ -0,0 +1,38 @@
+package chronicle
+
+import (
+	"github.com/fioprotocol/fio.etl/transform"
+)
+
+// fork rewinds the consumer to just before the fork point and sends a retraction on every queue. It must be called
+// from the websocket reader, since it waits for in-flight transforms so nothing from the abandoned fork is published
+// after the retraction.
+func (c *Consumer) fork(d []byte) error {
+	bn, err := transform.Fork(d)
+	if err != nil {
+		return err
+	}
+	log.Info("fork, retracting later records", "block_num", bn)
+	c.wg.Wait()
+
+	c.mux.Lock()
+	if c.Seen >= bn {
+		c.Seen = bn - 1
+	}
+	if c.Sent >= bn {
+		c.Sent = bn - 1
+	}
+	if c.Acked >= bn {
+		c.Acked = bn - 1
+	}
+	c.mux.Unlock()
+
+	for q, ch := range c.streams() {
+		r, err := transform.Retract(q, bn)
+		if err != nil {
+			return err
+		}
+		c.handOff(ch, c.tracker.message(bn, r))
+	}
+	return c.save()
+}
@@ -0,0 +1,43 @@
+package chronicle
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Ready returns nil if the consumer is making progress: chronicle is connected, every publisher is healthy, and a
+// message has arrived within the idle timeout. Paused and interactive consumers are not expected to be receiving.
+func (c *Consumer) Ready() error {
+	if !connected.get() {
+		return errors.New("chronicle is not connected")
+	}
+	c.mux.Lock()
+	publishers := c.publishers
+	c.mux.Unlock()
+	for name, p := range publishers {
+		if err := p.Health(); err != nil {
+			return fmt.Errorf("%s publisher: %v", name, err)
+		}
+	}
+	idle := c.cfg.Limits.IdleTimeout
+	if !c.Interactive && !c.paused() && c.idleFor() > idle {
+		return fmt.Errorf("no message from chronicle for more than %v", idle)
+	}
+	return nil
+}
+
+// HealthzHandler reports that the process is up
+func (c *Consumer) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// ReadyzHandler returns 200 when Ready, otherwise 503 and the reason.
+func (c *Consumer) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := c.Ready(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,51 @@
+package chronicle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/config"
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+type fakePublisher struct {
+	health error
+}
+
+func (f *fakePublisher) Publish(msg *queue.Message) error { return nil }
+func (f *fakePublisher) Flush() error                     { return nil }
+func (f *fakePublisher) Close() error                     { return nil }
+func (f *fakePublisher) Health() error                    { return f.health }
+
+func TestReady(t *testing.T) {
+	cfg := config.Default()
+	cfg.Checkpoint = "does-not-exist.json"
+	c, err := NewConsumer(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Ready() == nil {
+		t.Error("should not be ready before chronicle connects")
+	}
+	connected.set(true)
+	defer func() { connected.set(false) }()
+	pub := &fakePublisher{}
+	c.publishers = map[string]queue.Publisher{"block": pub}
+	if err = c.Ready(); err != nil {
+		t.Error("expected ready:", err)
+	}
+	pub.health = errors.New("reconnecting")
+	rec := httptest.NewRecorder()
+	c.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with an unhealthy publisher, got %d", rec.Code)
+	}
+	pub.health = nil
+	c.last = time.Now().Add(-2 * cfg.Limits.IdleTimeout)
+	if c.Ready() == nil {
+		t.Error("should not be ready when chronicle has been idle")
+	}
+}
@@ -0,0 +1,92 @@
+package chronicle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+// streams maps each output stream to the channel its records are sent on
+func (c *Consumer) streams() map[string]chan *queue.Message {
+	return map[string]chan *queue.Message{
+		"block":    c.blockChan,
+		"tx":       c.txChan,
+		"row":      c.rowChan,
+		"misc":     c.miscChan,
+		"transfer": c.xferChan,
+	}
+}
+
+var errProducerStopped = errors.New("producer has stopped")
+
+// handOff gives a record to the producer reading ch. Once that producer has stopped, or the producers are being closed,
+// nothing reads ch any more, so the record is confirmed as failed instead and its block is never acknowledged.
+func (c *Consumer) handOff(ch chan *queue.Message, m *queue.Message) {
+	select {
+	case ch <- m:
+	case <-c.quit[ch]:
+		m.Confirm(errProducerStopped)
+	case <-c.producing.Done():
+		m.Confirm(errProducerStopped)
+	}
+}
+
+// fail stops the consumer, only the first error is kept.
+func (c *Consumer) fail(err error) {
+	c.failOnce.Do(func() {
+		c.failErr = err
+		stopped.set(true)
+		c.cancel()
+	})
+}
+
+// finish runs once consume has returned and every transform has completed: it lets the producers publish what is
+// left, writes the final checkpoint, closes the recording, and reports the result on Done.
+func (c *Consumer) finish(err error, closeProducers func()) {
+	closeProducers()
+	c.producers.Wait()
+	if c.dead != nil {
+		if e := c.dead.Close(); e != nil {
+			log.Error("closing dead letters", "error", e)
+		}
+	}
+	c.checkpoint()
+	if c.recorder != nil {
+		// the recording has to be complete before Done is reported, main exits right after
+		if e := c.recorder.Close(); e != nil {
+			log.Error("closing recording", "file", c.cfg.Record, "error", e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	if c.exitDelay > 0 {
+		time.Sleep(c.exitDelay)
+	}
+	c.done <- err
+}
+
+// Done delivers the result of a chronicle session once it has ended and been drained, a nil error means the session
+// ended cleanly.
+func (c *Consumer) Done() <-chan error {
+	return c.done
+}
+
+// Shutdown stops reading from chronicle, waits for in-flight messages to be transformed and published, and saves the
+// checkpoint. It returns an error if the session failed or the drain did not complete before ctx expired.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	if !connected.get() {
+		return c.save()
+	}
+	log.Info("shutting down, draining in-flight messages")
+	stopped.set(true)
+	c.cancel()
+	select {
+	case err := <-c.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,122 @@
+package chronicle
+
+import (
+	"sync"
+
+	"github.com/fioprotocol/fio.etl/metrics"
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+// output is a transformed record and the stream it is published on
+type output struct {
+	ch   chan *queue.Message
+	body []byte
+}
+
+// task is a single chronicle message, seq is the order it was received in.
+type task struct {
+	seq     uint64
+	bn      uint32
+	msgtype string
+	data    []byte
+	out     []output
+}
+
+// pipeline transforms messages on a fixed pool of workers per message type and publishes the results in the order the
+// messages were received. Only the websocket reader submits tasks; once the in-flight limit is reached submitting
+// blocks, which stops the reader until the publishers catch up.
+type pipeline struct {
+	tracker *tracker
+	wg      *sync.WaitGroup
+	send    func(ch chan *queue.Message, m *queue.Message)
+	pools   map[string]chan *task
+	results chan *task
+	slots   chan struct{}
+	seq     uint64
+	depth   int
+}
+
+// newPipeline allows up to depth messages to be in flight, counted from submission until their records have been
+// handed to the producers with send. Every submitted task is added to wg until then, so send must not block forever.
+func newPipeline(t *tracker, wg *sync.WaitGroup, depth int, send func(ch chan *queue.Message, m *queue.Message)) *pipeline {
+	p := &pipeline{
+		tracker: t,
+		wg:      wg,
+		send:    send,
+		pools:   make(map[string]chan *task),
+		results: make(chan *task, depth),
+		slots:   make(chan struct{}, depth),
+		depth:   depth,
+	}
+	go p.resequence()
+	return p
+}
+
+// addPool starts workers that run transform for each of the message types, transform adds its records to t.out.
+func (p *pipeline) addPool(workers int, transform func(t *task), msgtypes ...string) {
+	tasks := make(chan *task, p.depth)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for t := range tasks {
+				transform(t)
+				p.results <- t
+			}
+		}()
+	}
+	for _, msgtype := range msgtypes {
+		p.pools[msgtype] = tasks
+	}
+}
+
+// handles reports whether a pool was added for the message type
+func (p *pipeline) handles(msgtype string) bool {
+	return p.pools[msgtype] != nil
+}
+
+// submit queues a message for its pool
+func (p *pipeline) submit(msgtype string, bn uint32, data []byte) {
+	p.pools[msgtype] <- p.start(msgtype, bn, data)
+}
+
+// emit publishes records that were produced without the pool, in order with everything submitted before it.
+func (p *pipeline) emit(bn uint32, out ...output) {
+	t := p.start("", bn, nil)
+	t.out = out
+	p.results <- t
+}
+
+func (p *pipeline) start(msgtype string, bn uint32, data []byte) *task {
+	p.slots <- struct{}{}
+	metrics.InFlight.Set(float64(len(p.slots)))
+	p.tracker.add(bn)
+	p.wg.Add(1)
+	p.seq += 1
+	return &task{seq: p.seq, bn: bn, msgtype: msgtype, data: data}
+}
+
+// inFlight is the number of messages submitted but not yet handed to the producers
+func (p *pipeline) inFlight() int {
+	return len(p.slots)
+}
+
+// resequence holds finished tasks until everything received before them has been sent, so each stream gets its
+// records in block order.
+func (p *pipeline) resequence() {
+	next := uint64(1)
+	done := make(map[uint64]*task)
+	for t := range p.results {
+		done[t.seq] = t
+		for done[next] != nil {
+			t = done[next]
+			delete(done, next)
+			next += 1
+			for _, o := range t.out {
+				p.send(o.ch, p.tracker.message(t.bn, o.body))
+			}
+			p.tracker.done(t.bn, nil)
+			<-p.slots
+			metrics.InFlight.Set(float64(len(p.slots)))
+			p.wg.Done()
+		}
+	}
+}
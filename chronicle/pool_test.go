@@ -0,0 +1,74 @@
+package chronicle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+func TestPipelineOrder(t *testing.T) {
+	var wg sync.WaitGroup
+	out := make(chan *queue.Message, 10)
+	pipe := newPipeline(newTracker(), &wg, 4, func(ch chan *queue.Message, m *queue.Message) { ch <- m })
+	pipe.addPool(4, func(t *task) {
+		// earlier messages finish last
+		time.Sleep(time.Duration(10-t.bn) * 5 * time.Millisecond)
+		t.out = append(t.out, output{out, []byte{byte(t.bn)}})
+	}, "TBL_ROW")
+	for bn := uint32(1); bn <= 8; bn++ {
+		if bn == 5 {
+			pipe.emit(bn, output{out, []byte{byte(bn)}})
+			continue
+		}
+		pipe.submit("TBL_ROW", bn, nil)
+	}
+	wg.Wait()
+	close(out)
+	want := byte(1)
+	for m := range out {
+		if m.Body[0] != want {
+			t.Fatalf("expected record %d, got %d", want, m.Body[0])
+		}
+		want += 1
+	}
+	if pipe.inFlight() != 0 {
+		t.Error("pipeline should be empty")
+	}
+}
+
+// TestPipelineProducerStopped hands records to a stream whose producer has stopped, the pipeline must still drain and
+// the blocks must be left unacknowledged.
+func TestPipelineProducerStopped(t *testing.T) {
+	var wg sync.WaitGroup
+	out := make(chan *queue.Message)
+	quit := make(chan interface{})
+	close(quit)
+	c := &Consumer{
+		tracker:   newTracker(),
+		quit:      map[chan *queue.Message]chan interface{}{out: quit},
+		producing: context.Background(),
+	}
+	pipe := newPipeline(c.tracker, &wg, 2, c.handOff)
+	pipe.addPool(1, func(t *task) {
+		t.out = append(t.out, output{out, []byte{byte(t.bn)}})
+	}, "TBL_ROW")
+	for bn := uint32(1); bn <= 8; bn++ {
+		pipe.submit("TBL_ROW", bn, nil)
+	}
+	drained := make(chan interface{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline blocked on a stopped producer")
+	}
+	if low, ok := c.tracker.lowest(); !ok || low != 1 {
+		t.Errorf("expected block 1 to stay pending, got %d %v", low, ok)
+	}
+}
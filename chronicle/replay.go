@@ -0,0 +1,104 @@
+package chronicle
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/fioprotocol/fio.etl/config"
+	"github.com/fioprotocol/fio.etl/deadletter"
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+// Replay runs the dead letters in file through the transforms again and publishes the results using sink. The file
+// is first moved aside so a running consumer can keep adding to it, letters that fail again are appended back to
+// file. If a previous replay was interrupted it is resumed.
+func Replay(cfg *config.Config, sink queue.Factory, file string) (replayed int, failed int, err error) {
+	work := file + ".replaying"
+	if _, err = os.Stat(work); os.IsNotExist(err) {
+		if err = os.Rename(file, work); os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	publishers := make(map[string]queue.Publisher)
+	defer func() {
+		for _, p := range publishers {
+			_ = p.Close()
+		}
+	}()
+	for name, q := range cfg.Queues.Map() {
+		if publishers[name], err = sink(q); err != nil {
+			delete(publishers, name)
+			return
+		}
+	}
+
+	out := deadletter.NewFile(file)
+	var mux sync.Mutex
+	failures := make(map[*deadletter.Letter]bool)
+	fail := func(l *deadletter.Letter, err error) {
+		mux.Lock()
+		defer mux.Unlock()
+		if failures[l] {
+			return
+		}
+		failures[l] = true
+		if e := out.Write(deadletter.New(l.Msgtype, l.BlockNum, l.Payload, err)); e != nil {
+			log.Error("storing dead letter", "block_num", l.BlockNum, "msgtype", l.Msgtype, "error", e)
+		}
+	}
+
+	f, err := os.Open(work)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	err = deadletter.Read(f, func(l *deadletter.Letter) error {
+		replayed += 1
+		msgtype, bn := l.Msgtype, l.BlockNum
+		if msgtype == "" {
+			// the message couldn't be decoded at all the first time
+			s := &msgSummary{}
+			if err := json.Unmarshal(l.Payload, s); err != nil {
+				fail(l, err)
+				return nil
+			}
+			b, _ := strconv.Atoi(s.Data.BlockNum)
+			msgtype, bn = s.Msgtype, uint32(b)
+		}
+		records, err := transformMessage(msgtype, bn, l.Payload, cfg.FallbackUrl)
+		if err != nil {
+			fail(l, err)
+			return nil
+		}
+		for _, r := range records {
+			err = publishers[r.stream].Publish(&queue.Message{BlockNum: bn, Body: r.body, Done: func(err error) {
+				if err != nil {
+					fail(l, err)
+				}
+			}})
+			if err != nil {
+				fail(l, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for name, p := range publishers {
+		if err = p.Flush(); err != nil {
+			log.Error("flushing replayed records", "queue", name, "error", err)
+			return
+		}
+	}
+	mux.Lock()
+	failed = len(failures)
+	mux.Unlock()
+	return replayed, failed, os.Remove(work)
+}
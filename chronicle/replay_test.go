@@ -0,0 +1,65 @@
+package chronicle
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fioprotocol/fio.etl/config"
+	"github.com/fioprotocol/fio.etl/deadletter"
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "deadletters.jsonl")
+	out := deadletter.NewFile(file)
+	// no transform for this msgtype, so it replays without producing records
+	if err = out.Write(deadletter.New("FORK", 5, []byte(`{"msgtype":"FORK"}`), errors.New("first"))); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.Write(deadletter.New("TBL_ROW", 6, []byte(`{"data":`), errors.New("second"))); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := func(string) (queue.Publisher, error) { return &fakePublisher{}, nil }
+	replayed, failed, err := Replay(config.Default(), sink, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 2 || failed != 1 {
+		t.Errorf("expected 2 replayed and 1 failed, got %d and %d", replayed, failed)
+	}
+	if _, err = os.Stat(file + ".replaying"); !os.IsNotExist(err) {
+		t.Error("the replaying file should be removed")
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var letters []*deadletter.Letter
+	if err = deadletter.Read(f, func(l *deadletter.Letter) error {
+		letters = append(letters, l)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].BlockNum != 6 || letters[0].Error == "second" {
+		t.Errorf("expected the TBL_ROW letter stored again with the new error, got %+v", letters)
+	}
+
+	// nothing to replay
+	if err = os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if replayed, _, err = Replay(config.Default(), sink, file); err != nil || replayed != 0 {
+		t.Errorf("replaying a missing file should do nothing, got %d %v", replayed, err)
+	}
+}
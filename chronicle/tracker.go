@@ -0,0 +1,70 @@
+package chronicle
+
+import (
+	"sync"
+
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+// tracker counts the records for each block that have been handed to a publisher but not yet confirmed, a block is
+// only safe to acknowledge to chronicle once nothing at or below it is pending.
+type tracker struct {
+	mux     sync.Mutex
+	pending map[uint32]int
+	// failed blocks stay pending so the acknowledged block never passes them, the session is restarted and chronicle
+	// resends from the last acknowledged block.
+	failed map[uint32]bool
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		pending: make(map[uint32]int),
+		failed:  make(map[uint32]bool),
+	}
+}
+
+func (t *tracker) add(bn uint32) {
+	t.mux.Lock()
+	t.pending[bn] += 1
+	t.mux.Unlock()
+}
+
+func (t *tracker) done(bn uint32, err error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if err != nil {
+		t.failed[bn] = true
+		return
+	}
+	t.pending[bn] -= 1
+	if t.pending[bn] <= 0 && !t.failed[bn] {
+		delete(t.pending, bn)
+	}
+}
+
+// lowest returns the lowest block with unconfirmed records, ok is false if nothing is pending.
+func (t *tracker) lowest() (bn uint32, ok bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	for b := range t.pending {
+		if !ok || b < bn {
+			bn, ok = b, true
+		}
+	}
+	return
+}
+
+// message wraps a record for publishing, tracking it until the publisher confirms it.
+func (t *tracker) message(bn uint32, body []byte) *queue.Message {
+	t.add(bn)
+	return &queue.Message{
+		BlockNum: bn,
+		Body:     body,
+		Done: func(err error) {
+			if err != nil {
+				log.Error("record was not confirmed", "block_num", bn, "error", err)
+			}
+			t.done(bn, err)
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package chronicle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	tr := newTracker()
+	if _, ok := tr.lowest(); ok {
+		t.Fatal("new tracker should have nothing pending")
+	}
+	tr.add(10)
+	m := tr.message(10, []byte("{}"))
+	tr.add(11)
+	tr.done(10, nil)
+	if low, _ := tr.lowest(); low != 10 {
+		t.Errorf("block 10 still has an unconfirmed record, lowest was %d", low)
+	}
+	m.Confirm(nil)
+	if low, _ := tr.lowest(); low != 11 {
+		t.Errorf("expected lowest pending 11, got %d", low)
+	}
+	tr.message(11, []byte("{}")).Confirm(errors.New("lost"))
+	tr.done(11, nil)
+	if low, ok := tr.lowest(); !ok || low != 11 {
+		t.Error("a failed block must stay pending")
+	}
+}
@@ -0,0 +1,106 @@
+package chronicle
+
+import (
+	"fmt"
+
+	"github.com/fioprotocol/fio.etl/deadletter"
+	"github.com/fioprotocol/fio.etl/metrics"
+	"github.com/fioprotocol/fio.etl/transform"
+)
+
+// record is a transformed record and the stream it is published on
+type record struct {
+	stream string
+	body   []byte
+}
+
+// transforms are keyed by msgtype, name is the label used for the transform error metric.
+var transforms = map[string]struct {
+	name string
+	fn   func(msgtype string, data []byte, fallback string) ([]record, error)
+}{
+	"TBL_ROW": {"Table", func(msgtype string, data []byte, fallback string) ([]record, error) {
+		a, err := transform.Table(data)
+		return records("row", a), err
+	}},
+	"BLOCK": {"Block", func(msgtype string, data []byte, fallback string) ([]record, error) {
+		a, b, err := transform.Block(data, fallback)
+		return append(records("block", a), records("block", b)...), err
+	}},
+	"PERMISSION":      {"Account", account},
+	"PERMISSION_LINK": {"Account", account},
+	"ACC_METADATA":    {"Account", account},
+	"ABI_UPD": {"Abi", func(msgtype string, data []byte, fallback string) ([]record, error) {
+		a, err := transform.Abi(data)
+		return records("misc", a), err
+	}},
+	"TX_TRACE": {"Trace", func(msgtype string, data []byte, fallback string) ([]record, error) {
+		a, err := transform.Trace(data)
+		if err != nil || a == nil {
+			return nil, err
+		}
+		out := records("tx", a)
+		xfers, err := transform.Transfers(a)
+		if err != nil {
+			err = fmt.Errorf("splitting transfers: %v", err)
+		}
+		for _, xfer := range xfers {
+			out = append(out, records("transfer", xfer)...)
+		}
+		return out, err
+	}},
+}
+
+func account(msgtype string, data []byte, fallback string) ([]record, error) {
+	a, err := transform.Account(data, msgtype)
+	return records("misc", a), err
+}
+
+// records drops empty bodies, transforms return nil for messages that aren't indexed
+func records(stream string, bodies ...[]byte) []record {
+	out := make([]record, 0, len(bodies))
+	for _, b := range bodies {
+		if len(b) > 0 {
+			out = append(out, record{stream: stream, body: b})
+		}
+	}
+	return out
+}
+
+// transformMessage runs the transform for msgtype. A failed message may still produce some records, for example a
+// trace whose transfers could not be split out.
+func transformMessage(msgtype string, bn uint32, data []byte, fallback string) ([]record, error) {
+	t, ok := transforms[msgtype]
+	if !ok {
+		return nil, nil
+	}
+	out, err := t.fn(msgtype, data, fallback)
+	if err != nil {
+		log.Error("transform failed", "block_num", bn, "msgtype", msgtype, "error", err)
+		metrics.TransformErrors.WithLabelValues(t.name).Inc()
+	}
+	return out, err
+}
+
+// transform fills in a pipeline task's output, storing the message as a dead letter if it failed.
+func (c *Consumer) transform(t *task, fallback string) {
+	out, err := transformMessage(t.msgtype, t.bn, t.data, fallback)
+	streams := c.streams()
+	for _, r := range out {
+		t.out = append(t.out, output{streams[r.stream], r.body})
+	}
+	if err != nil {
+		c.deadLetter(deadletter.New(t.msgtype, t.bn, t.data, err))
+	}
+}
+
+// deadLetter stores a failed message, if dead letters are enabled.
+func (c *Consumer) deadLetter(l *deadletter.Letter) {
+	if c.dead == nil {
+		return
+	}
+	metrics.DeadLetters.Inc()
+	if err := c.dead.Write(l); err != nil {
+		log.Error("storing dead letter", "block_num", l.BlockNum, "msgtype", l.Msgtype, "error", err)
+	}
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/fioprotocol/fio.etl/chronicle"
+	"github.com/fioprotocol/fio.etl/config"
 	"github.com/fioprotocol/fio.etl/logging"
+	"github.com/fioprotocol/fio.etl/queue"
+	"github.com/fioprotocol/fio.etl/transform"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 /*
@@ -12,11 +22,158 @@ fioetl accepts messages from a chronicle daemon, applies normalization, and send
 */
 
 func main() {
-	elog, ilog, _ := logging.Setup(" [fioetl-consumer] ")
-	ilog.Println("fioetl starting")
+	log := logging.New("main")
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(log, os.Args[2:])
+		return
+	}
+	log.Info("fioetl starting")
 
-	c := chronicle.NewConsumer("")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("loading configuration", "error", err)
+	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(level)
+	sink, err := newSink(cfg)
+	if err != nil {
+		log.Fatal("configuring sink", "error", err)
+	}
+	log.Info("publishing", "sink", cfg.Sink.Type)
+	configureTransforms(log, cfg)
+
+	c, err := chronicle.NewConsumer(cfg, sink)
+	if err != nil {
+		log.Fatal("starting consumer", "error", err)
+	}
 	router := mux.NewRouter()
-	router.HandleFunc("/chronicle", c.Handler)
-	elog.Fatal(http.ListenAndServe(":8844", router))
+	router.HandleFunc(cfg.WebsocketPath, c.Handler)
+	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/healthz", c.HealthzHandler)
+	router.HandleFunc("/readyz", c.ReadyzHandler)
+	srv := &http.Server{Addr: cfg.Listen, Handler: router}
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- srv.ListenAndServe()
+	}()
+	var admin *http.Server
+	if cfg.AdminListen != "" {
+		admin = &http.Server{Addr: cfg.AdminListen, Handler: c.AdminHandler()}
+		go func() {
+			srvErr <- admin.ListenAndServe()
+		}()
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	exitCode := 0
+	drain := true
+	select {
+	case sig := <-sigs:
+		log.Info("received signal", "signal", sig)
+	case err = <-c.Done():
+		// the chronicle session ended and was drained, exit so that we are restarted with a fresh connection.
+		drain = false
+		if err != nil {
+			exitCode = 1
+		}
+	case err = <-srvErr:
+		log.Error("http server failed", "error", err)
+		exitCode = 1
+	}
+
+	// docker's stop_grace_period in the example compose file is 90s, leave some room to exit.
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Second)
+	if drain {
+		if err = c.Shutdown(ctx); err != nil {
+			log.Final("shutdown did not complete cleanly", "error", err)
+			exitCode = 1
+		}
+	}
+	if err = srv.Shutdown(ctx); err != nil {
+		log.Error("stopping http server", "error", err)
+	}
+	if admin != nil {
+		if err = admin.Shutdown(ctx); err != nil {
+			log.Error("stopping admin server", "error", err)
+		}
+	}
+	cancel()
+	log.Info("fioetl exiting", "exit_code", exitCode)
+	os.Exit(exitCode)
+}
+
+// replay publishes the dead letters in the configured file again, `fioetl replay [flags]` takes the same flags and
+// environment as the consumer.
+func replay(log *logging.Logger, args []string) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal("loading configuration", "error", err)
+	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(level)
+	if cfg.DeadLetter.File == "" {
+		log.Fatal("no dead letter file is configured")
+	}
+	sink, err := newSink(cfg)
+	if err != nil {
+		log.Fatal("configuring sink", "error", err)
+	}
+	configureTransforms(log, cfg)
+	replayed, failed, err := chronicle.Replay(cfg, sink, cfg.DeadLetter.File)
+	if err != nil {
+		log.Fatal("replaying dead letters", "file", cfg.DeadLetter.File, "replayed", replayed, "error", err)
+	}
+	log.Info("replayed dead letters", "file", cfg.DeadLetter.File, "replayed", replayed, "failed", failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// configureTransforms restores the ABIs learned before a restart and sets the chain id for key recovery
+func configureTransforms(log *logging.Logger, cfg *config.Config) {
+	if cfg.AbiDir != "" {
+		if err := transform.LoadAbis(cfg.AbiDir); err != nil {
+			log.Fatal("loading ABIs", "dir", cfg.AbiDir, "error", err)
+		}
+	}
+	if err := transform.SetChainId(cfg.ChainId); err != nil {
+		log.Fatal("setting chain id", "error", err)
+	}
+}
+
+// newSink builds the publisher factory for the configured sink
+func newSink(cfg *config.Config) (queue.Factory, error) {
+	switch cfg.Sink.Type {
+	case "rabbit":
+		return queue.Rabbit(queue.RabbitOptions{
+			Url:               cfg.RabbitUrl(),
+			ReconnectDeadline: cfg.Sink.Rabbit.ReconnectDeadline,
+		}), nil
+	case "elasticsearch":
+		es := cfg.Sink.Elasticsearch
+		return queue.Elastic(queue.ElasticOptions{
+			Url:           es.Url,
+			User:          es.User,
+			Password:      es.Password,
+			Insecure:      es.Insecure,
+			BatchSize:     es.BatchSize,
+			FlushInterval: es.FlushInterval,
+		}), nil
+	case "postgres":
+		pg := cfg.Sink.Postgres
+		return queue.Postgres(queue.PostgresOptions{
+			Url:           pg.Url,
+			BatchSize:     pg.BatchSize,
+			FlushInterval: pg.FlushInterval,
+			CopyThreshold: pg.CopyThreshold,
+		}), nil
+	case "kafka":
+		return queue.Kafka(queue.KafkaOptions{
+			Brokers: cfg.Sink.Kafka.Brokers,
+			Version: cfg.Sink.Kafka.Version,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown sink %q", cfg.Sink.Type)
 }
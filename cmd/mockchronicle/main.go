@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/fioprotocol/fio.etl/logging"
+	"github.com/fioprotocol/fio.etl/recording"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/*
+mockchronicle plays a recording made with FIOETL_RECORD back to fioetl, standing in for chronicle and a FIO node.
+*/
+
+func main() {
+	log := logging.New("mockchronicle")
+	file := flag.String("file", "chronicle.rec", "recording to play")
+	opts := recording.PlayerOptions{}
+	flag.StringVar(&opts.Url, "url", "ws://127.0.0.1:8844/chronicle", "fioetl's chronicle websocket")
+	start := flag.Uint("start", 0, "first block to send, 0 for the beginning of the recording")
+	maxUnacked := flag.Uint("max-unacked", 1000, "pause while this many blocks are unacknowledged")
+	flag.BoolVar(&opts.Interactive, "interactive", false, "only send block ranges fioetl requests")
+	flag.DurationVar(&opts.AckTimeout, "ack-timeout", 0, "wait this long for the final acknowledgment (default 1m)")
+	flag.Parse()
+	opts.Start, opts.MaxUnacked = uint32(*start), uint32(*maxUnacked)
+
+	rec, err := recording.Open(*file)
+	if err != nil {
+		log.Fatal("opening recording", "file", *file, "error", err)
+	}
+	defer rec.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	stats, err := recording.NewPlayer(rec, opts).Play(ctx)
+	fields := []interface{}{
+		"messages", stats.Messages, "bytes", stats.Bytes, "blocks", stats.Blocks, "completed", stats.Completed,
+		"acked", stats.Acked, "elapsed", stats.Elapsed.String(),
+	}
+	if stats.Elapsed.Seconds() > 0 {
+		fields = append(fields, "blocks_per_second", float64(stats.Blocks)/stats.Elapsed.Seconds())
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Error("playback failed", append(fields, "error", err)...)
+		rec.Close()
+		os.Exit(1)
+	}
+	log.Info("playback finished", fields...)
+}
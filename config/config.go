@@ -0,0 +1,388 @@
+// Package config holds the settings for fioetl. Values come from (in increasing order of precedence) the defaults, a
+// YAML file, environment variables, and command line flags.
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/logging"
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	// Listen is the address the chronicle websocket server listens on
+	Listen string `yaml:"listen"`
+	// AdminListen is the address for the admin API, empty disables it. It should not be exposed publicly.
+	AdminListen string `yaml:"admin_listen"`
+	// WebsocketPath is the path chronicle connects to, it must match chronicle's EXP_WS_PATH
+	WebsocketPath string `yaml:"websocket_path"`
+	// Checkpoint is the file used to persist the consumer's position
+	Checkpoint string `yaml:"checkpoint"`
+	// FallbackUrl is a nodeos chain API, only used if deriving a block id fails
+	FallbackUrl string `yaml:"fallback_url"`
+	// Interactive is for use with chronicle's interactive mode, block ranges are requested through /backfill instead of
+	// chronicle scanning forward.
+	Interactive bool `yaml:"interactive"`
+
+	// LogLevel is one of debug, info, warn or error, it can also be changed with the admin API
+	LogLevel string `yaml:"log_level"`
+
+	DeadLetter DeadLetter `yaml:"dead_letter"`
+	// AbiDir is where learned ABIs are saved and loaded from at startup, ABI files can also be added to it by hand
+	AbiDir string `yaml:"abi_dir"`
+	// ChainId is used to recover the public keys that signed each transaction in a block, empty to skip it
+	ChainId string `yaml:"chain_id"`
+	// Record appends every message from chronicle to this file, it can be played back with mockchronicle
+	Record string `yaml:"record"`
+
+	Sink   Sink   `yaml:"sink"`
+	Queues Queues `yaml:"queues"`
+	Limits Limits `yaml:"limits"`
+}
+
+// Sink selects and configures the output, Type is one of rabbit, elasticsearch, postgres or kafka.
+type Sink struct {
+	Type          string        `yaml:"type"`
+	Rabbit        Rabbit        `yaml:"rabbit"`
+	Elasticsearch Elasticsearch `yaml:"elasticsearch"`
+	Postgres      Postgres      `yaml:"postgres"`
+	Kafka         Kafka         `yaml:"kafka"`
+}
+
+type Rabbit struct {
+	Url      string `yaml:"url"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// ReconnectDeadline is how long publishing waits for the broker to come back before fioetl gives up
+	ReconnectDeadline time.Duration `yaml:"reconnect_deadline"`
+}
+
+type Elasticsearch struct {
+	Url           string        `yaml:"url"`
+	User          string        `yaml:"user"`
+	Password      string        `yaml:"password"`
+	Insecure      bool          `yaml:"insecure"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+type Postgres struct {
+	Url           string        `yaml:"url"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	CopyThreshold int           `yaml:"copy_threshold"`
+}
+
+type Kafka struct {
+	Brokers []string `yaml:"brokers"`
+	Version string   `yaml:"version"`
+}
+
+// DeadLetter is where messages that fail to transform are stored, either appended to File or published on Queue
+// using the sink. Queue takes precedence, and both empty disables dead letters.
+type DeadLetter struct {
+	File  string `yaml:"file"`
+	Queue string `yaml:"queue"`
+}
+
+// Queues are the names of the queues (or topics) each stream is published to.
+type Queues struct {
+	Block    string `yaml:"block"`
+	Tx       string `yaml:"tx"`
+	Row      string `yaml:"row"`
+	Misc     string `yaml:"misc"`
+	Transfer string `yaml:"transfer"`
+}
+
+// Map returns the queue names keyed by stream
+func (q Queues) Map() map[string]string {
+	return map[string]string{
+		"block":    q.Block,
+		"tx":       q.Tx,
+		"row":      q.Row,
+		"misc":     q.Misc,
+		"transfer": q.Transfer,
+	}
+}
+
+type Limits struct {
+	// MaxInFlight is the number of messages being transformed before the websocket reader pauses
+	MaxInFlight int `yaml:"max_in_flight"`
+	// Workers is the number of transform workers for each message type, zero uses one per CPU
+	Workers int `yaml:"workers"`
+	// HeapLimitMiB restarts the consumer if the heap grows larger than this
+	HeapLimitMiB uint64 `yaml:"heap_limit_mib"`
+	// IdleTimeout closes the connection if chronicle hasn't sent anything for this long
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+// Default returns a Config with the values fioetl used before it was configurable.
+func Default() *Config {
+	return &Config{
+		Listen:        ":8844",
+		AdminListen:   "127.0.0.1:8845",
+		WebsocketPath: "/chronicle",
+		Checkpoint:    "chronicle.json",
+		LogLevel:      "info",
+		DeadLetter:    DeadLetter{File: "deadletters.jsonl"},
+		AbiDir:        "abis",
+		Sink: Sink{
+			Type: "rabbit",
+			Rabbit: Rabbit{
+				Url:               "amqp://rabbit:5672/",
+				User:              "guest",
+				Password:          "guest",
+				ReconnectDeadline: 5 * time.Minute,
+			},
+		},
+		Queues: Queues{
+			Block:    "block",
+			Tx:       "tx",
+			Row:      "row",
+			Misc:     "misc",
+			Transfer: "transfer",
+		},
+		Limits: Limits{
+			MaxInFlight:  256,
+			HeapLimitMiB: 4096,
+			IdleTimeout:  time.Minute,
+		},
+	}
+}
+
+// option is a setting that can be overridden by an environment variable or flag
+type option struct {
+	flag string
+	env  string
+	help string
+	ptr  func(c *Config) interface{}
+}
+
+var options = []option{
+	{"listen", "FIOETL_LISTEN", "address to listen on for chronicle", func(c *Config) interface{} { return &c.Listen }},
+	{"admin-listen", "FIOETL_ADMIN_LISTEN", "address for the admin API, empty to disable", func(c *Config) interface{} { return &c.AdminListen }},
+	{"ws-path", "FIOETL_WS_PATH", "websocket path chronicle connects to", func(c *Config) interface{} { return &c.WebsocketPath }},
+	{"checkpoint", "FIOETL_CHECKPOINT", "checkpoint file", func(c *Config) interface{} { return &c.Checkpoint }},
+	{"fallback-url", "FIOETL_FALLBACK_URL", "nodeos API used if deriving a block id fails", func(c *Config) interface{} { return &c.FallbackUrl }},
+	{"interactive", "FIOETL_INTERACTIVE", "request block ranges from chronicle's interactive mode", func(c *Config) interface{} { return &c.Interactive }},
+	{"log-level", "FIOETL_LOG_LEVEL", "debug, info, warn, or error", func(c *Config) interface{} { return &c.LogLevel }},
+	{"deadletter-file", "FIOETL_DEADLETTER_FILE", "file for messages that fail to transform", func(c *Config) interface{} { return &c.DeadLetter.File }},
+	{"deadletter-queue", "FIOETL_DEADLETTER_QUEUE", "queue for messages that fail to transform, instead of the file", func(c *Config) interface{} { return &c.DeadLetter.Queue }},
+	{"abi-dir", "FIOETL_ABI_DIR", "directory ABIs are loaded from and saved to, empty to disable", func(c *Config) interface{} { return &c.AbiDir }},
+	{"chain-id", "FIOETL_CHAIN_ID", "chain id for recovering transaction signing keys, empty to skip", func(c *Config) interface{} { return &c.ChainId }},
+	{"record", "FIOETL_RECORD", "record chronicle messages to this file", func(c *Config) interface{} { return &c.Record }},
+	{"sink", "SINK", "output: rabbit, elasticsearch, postgres, or kafka", func(c *Config) interface{} { return &c.Sink.Type }},
+	{"rabbit-url", "RABBIT_URL", "rabbitmq url", func(c *Config) interface{} { return &c.Sink.Rabbit.Url }},
+	{"rabbit-user", "RABBIT_USER", "rabbitmq user", func(c *Config) interface{} { return &c.Sink.Rabbit.User }},
+	{"rabbit-password", "RABBIT_PASSWORD", "rabbitmq password", func(c *Config) interface{} { return &c.Sink.Rabbit.Password }},
+	{"rabbit-reconnect-deadline", "RABBIT_RECONNECT_DEADLINE", "give up if rabbitmq is unavailable for this long", func(c *Config) interface{} { return &c.Sink.Rabbit.ReconnectDeadline }},
+	{"es-url", "ES_URL", "elasticsearch url", func(c *Config) interface{} { return &c.Sink.Elasticsearch.Url }},
+	{"es-user", "ES_USER", "elasticsearch user", func(c *Config) interface{} { return &c.Sink.Elasticsearch.User }},
+	{"es-password", "ES_PASSWORD", "elasticsearch password", func(c *Config) interface{} { return &c.Sink.Elasticsearch.Password }},
+	{"es-insecure", "ES_INSECURE", "skip elasticsearch TLS verification", func(c *Config) interface{} { return &c.Sink.Elasticsearch.Insecure }},
+	{"pg-url", "PG_URL", "postgres connection string", func(c *Config) interface{} { return &c.Sink.Postgres.Url }},
+	{"kafka-brokers", "KAFKA_BROKERS", "comma-separated list of kafka brokers", func(c *Config) interface{} { return &c.Sink.Kafka.Brokers }},
+	{"max-in-flight", "FIOETL_MAX_IN_FLIGHT", "messages being transformed before reading pauses", func(c *Config) interface{} { return &c.Limits.MaxInFlight }},
+	{"workers", "FIOETL_WORKERS", "transform workers per message type, 0 for one per CPU", func(c *Config) interface{} { return &c.Limits.Workers }},
+	{"heap-limit", "FIOETL_HEAP_LIMIT_MIB", "restart if the heap exceeds this many MiB", func(c *Config) interface{} { return &c.Limits.HeapLimitMiB }},
+	{"idle-timeout", "FIOETL_IDLE_TIMEOUT", "disconnect if chronicle sends nothing for this long", func(c *Config) interface{} { return &c.Limits.IdleTimeout }},
+}
+
+// set parses s into the value pointed to by ptr
+func set(ptr interface{}, s string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = s
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*p = i
+	case *uint64:
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		*p = i
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*p = d
+	case *[]string:
+		*p = strings.Split(s, ",")
+	default:
+		return fmt.Errorf("unsupported option type %T", ptr)
+	}
+	return nil
+}
+
+// flagValue holds a flag until the file and environment have been loaded, so that flags take precedence.
+type flagValue struct {
+	raw   string
+	isSet bool
+	bool  bool
+}
+
+func (f *flagValue) String() string {
+	return f.raw
+}
+
+func (f *flagValue) Set(s string) error {
+	f.raw, f.isSet = s, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.bool
+}
+
+// Load builds the configuration from the defaults, the file named by -config (or FIOETL_CONFIG), the environment,
+// and the command line arguments, then validates it.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("fioetl", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("FIOETL_CONFIG"), "YAML configuration file")
+	c := Default()
+	values := make([]*flagValue, len(options))
+	for i, o := range options {
+		_, isBool := o.ptr(c).(*bool)
+		values[i] = &flagValue{bool: isBool}
+		fs.Var(values[i], o.flag, fmt.Sprintf("%s (env %s)", o.help, o.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *file != "" {
+		b, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", *file, err)
+		}
+	}
+
+	// the example docker-compose file has always set these for the fallback API
+	if os.Getenv("HOST") != "" && os.Getenv("FALLBACK_PORT") != "" {
+		c.FallbackUrl = "http://" + os.Getenv("HOST") + ":" + os.Getenv("FALLBACK_PORT")
+	}
+	for _, o := range options {
+		if v, ok := os.LookupEnv(o.env); ok {
+			if err := set(o.ptr(c), v); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %v", o.env, err)
+			}
+		}
+	}
+	for i, o := range options {
+		if !values[i].isSet {
+			continue
+		}
+		if err := set(o.ptr(c), values[i].raw); err != nil {
+			return nil, fmt.Errorf("invalid value for -%s: %v", o.flag, err)
+		}
+	}
+	return c, c.Validate()
+}
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, a...))
+		}
+	}
+	checkUrl := func(name string, s string, schemes ...string) {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid url", name, s))
+			return
+		}
+		for _, scheme := range schemes {
+			if u.Scheme == scheme {
+				return
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s must use one of %v", name, schemes))
+	}
+
+	check(c.Listen != "", "listen address is required")
+	check(c.AdminListen == "" || c.AdminListen != c.Listen, "admin api must listen on a different address")
+	check(strings.HasPrefix(c.WebsocketPath, "/"), "websocket path must start with /")
+	check(c.Checkpoint != "", "checkpoint file is required")
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.ChainId != "" {
+		id, err := hex.DecodeString(c.ChainId)
+		check(err == nil && len(id) == 32, "chain id %q must be 64 hex characters", c.ChainId)
+	}
+	if c.FallbackUrl != "" {
+		checkUrl("fallback url", c.FallbackUrl, "http", "https")
+	}
+
+	switch c.Sink.Type {
+	case "rabbit":
+		checkUrl("rabbit url", c.Sink.Rabbit.Url, "amqp", "amqps")
+		check(c.Sink.Rabbit.ReconnectDeadline > 0, "rabbit reconnect deadline must be greater than zero")
+	case "elasticsearch":
+		checkUrl("elasticsearch url", c.Sink.Elasticsearch.Url, "http", "https")
+		check(c.Sink.Elasticsearch.BatchSize >= 0, "elasticsearch batch size can't be negative")
+	case "postgres":
+		check(c.Sink.Postgres.Url != "", "postgres url is required")
+		check(c.Sink.Postgres.BatchSize >= 0, "postgres batch size can't be negative")
+	case "kafka":
+		check(len(c.Sink.Kafka.Brokers) > 0 && c.Sink.Kafka.Brokers[0] != "", "at least one kafka broker is required")
+	default:
+		problems = append(problems, fmt.Sprintf("unknown sink type %q", c.Sink.Type))
+	}
+
+	seen := make(map[string]bool)
+	for stream, name := range c.Queues.Map() {
+		check(name != "", "queue name for %s is required", stream)
+		check(name == "" || !seen[name], "queue name %q is used more than once", name)
+		seen[name] = true
+	}
+	check(!seen[c.DeadLetter.Queue], "dead letter queue %q is also used for a stream", c.DeadLetter.Queue)
+	check(c.DeadLetter.Queue == "" || c.Sink.Type != "postgres", "the postgres sink can't publish dead letters, use a file")
+
+	check(c.Limits.MaxInFlight > 0, "max in flight must be greater than zero")
+	check(c.Limits.Workers >= 0, "workers can't be negative")
+	check(c.Limits.HeapLimitMiB > 0, "heap limit must be greater than zero")
+	check(c.Limits.IdleTimeout >= time.Second, "idle timeout must be at least 1s")
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RabbitUrl returns the rabbit url with the credentials added
+func (c *Config) RabbitUrl() string {
+	u, err := url.Parse(c.Sink.Rabbit.Url)
+	if err != nil {
+		return c.Sink.Rabbit.Url
+	}
+	if c.Sink.Rabbit.User != "" {
+		u.User = url.UserPassword(c.Sink.Rabbit.User, c.Sink.Rabbit.Password)
+	}
+	return u.String()
+}
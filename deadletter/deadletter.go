@@ -0,0 +1,136 @@
+// Package deadletter stores chronicle messages that could not be transformed, so they can be replayed after a fix.
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fioprotocol/fio.etl/queue"
+)
+
+// Letter is a chronicle message that failed, Payload is the message exactly as chronicle sent it.
+type Letter struct {
+	Id         string    `json:"id"`
+	RecordType string    `json:"record_type"`
+	Time       time.Time `json:"time"`
+	Msgtype    string    `json:"msgtype"`
+	BlockNum   uint32    `json:"block_num"`
+	Error      string    `json:"error"`
+	Payload    []byte    `json:"payload"`
+}
+
+// New builds a letter for a failed message
+func New(msgtype string, blockNum uint32, payload []byte, err error) *Letter {
+	now := time.Now().UTC()
+	return &Letter{
+		Id:         fmt.Sprintf("%d-%s-%d", blockNum, msgtype, now.UnixNano()),
+		RecordType: "deadletter",
+		Time:       now,
+		Msgtype:    msgtype,
+		BlockNum:   blockNum,
+		Error:      err.Error(),
+		Payload:    payload,
+	}
+}
+
+// Writer stores letters, Write only returns once the letter is durable.
+type Writer interface {
+	Write(l *Letter) error
+	Close() error
+}
+
+// File appends letters to a file as JSON lines. The file is opened for each write, so it can be moved aside for
+// replaying while fioetl is running.
+type File struct {
+	path string
+	mux  sync.Mutex
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Write(l *Letter) error {
+	line, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (f *File) Close() error {
+	return nil
+}
+
+// Queue publishes letters on a dedicated queue using the configured sink.
+type Queue struct {
+	pub queue.Publisher
+	mux sync.Mutex
+}
+
+func NewQueue(pub queue.Publisher) *Queue {
+	return &Queue{pub: pub}
+}
+
+func (q *Queue) Write(l *Letter) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	confirmed := make(chan error, 1)
+	err = q.pub.Publish(&queue.Message{BlockNum: l.BlockNum, Body: body, Done: func(err error) {
+		confirmed <- err
+	}})
+	if err != nil {
+		return err
+	}
+	// letters are rare, waiting for each one keeps them from being acked to chronicle before they are stored.
+	if err = q.pub.Flush(); err != nil {
+		return err
+	}
+	return <-confirmed
+}
+
+func (q *Queue) Close() error {
+	return q.pub.Close()
+}
+
+// Read calls fn for each letter in r, in order.
+func Read(r io.Reader, fn func(l *Letter) error) error {
+	scanner := bufio.NewScanner(r)
+	// chronicle messages for large transactions can be several megabytes
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		l := &Letter{}
+		if err := json.Unmarshal(scanner.Bytes(), l); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -3,16 +3,19 @@ module github.com/fioprotocol/fio.etl
 go 1.14
 
 require (
+	github.com/Shopify/sarama v1.27.2
 	github.com/fioprotocol/fio-go v1.0.0
 	github.com/gorilla/mux v1.7.4
 	github.com/gorilla/websocket v1.4.2
 	github.com/importcjj/trie-go v0.0.0-20160919093426-b824e112ac91
-	github.com/kr/pretty v0.2.0 // indirect
+	github.com/lib/pq v1.8.0
 	github.com/mr-tron/base58 v1.2.0
 	github.com/petermattis/goid v0.0.0-20180202154549-b0b1615b78e5 // indirect
+	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/sasha-s/go-deadlock v0.2.0
 	github.com/streadway/amqp v1.0.0
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
 	golang.org/x/text v0.3.3
-	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
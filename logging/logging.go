@@ -1,18 +1,226 @@
+// Package logging writes structured, leveled logs as one JSON object per line. The level is shared by every logger and
+// can be changed at runtime, repeated warnings and errors are sampled so a failing sink can't flood the output. Fatal
+// and Final entries, which explain why the process stopped, are never sampled.
 package logging
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func Setup(prefix string) (err *log.Logger, info *log.Logger, debug *log.Logger) {
-	var (
-		e *log.Logger
-		i *log.Logger
-		d *log.Logger
-	)
-	e = log.New(os.Stderr, prefix+" ERROR: ", log.Lshortfile|log.LstdFlags|log.Lmsgprefix)
-	i = log.New(os.Stdout, prefix+"  INFO: ", log.Lshortfile|log.LstdFlags|log.Lmsgprefix)
-	d = log.New(os.Stdout, prefix+" DEBUG: ", log.Lshortfile|log.LstdFlags|log.Lmsgprefix)
-	return e, i, d
+type Level int32
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("level(%d)", l)
+	}
+	return levelNames[l]
+}
+
+// ParseLevel accepts debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q", s)
+}
+
+var level = int32(Info)
+
+// SetLevel changes the level for every logger
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&level))
+}
+
+var (
+	outMux sync.Mutex
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// Logger writes entries for one component, with fields that are added to every entry.
+type Logger struct {
+	component string
+	fields    []interface{}
+}
+
+// New returns a logger for a package or other component
+func New(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// With returns a logger that adds the key/value pairs to every entry, for example
+// log.With("queue", name).Error("flush failed", "error", err)
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	return &Logger{component: l.component, fields: append(fields, kv...)}
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.write(Debug, msg, kv, false)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.write(Info, msg, kv, false)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.write(Warn, msg, kv, true)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.write(Error, msg, kv, true)
+}
+
+// Final logs an error the process is about to exit with, unlike Error it is never sampled.
+func (l *Logger) Final(msg string, kv ...interface{}) {
+	l.write(Error, msg, kv, false)
+}
+
+// Fatal logs an error and exits
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.write(Error, msg, kv, false)
+	os.Exit(1)
+}
+
+// write formats and writes an entry, when sample is set repeated messages are limited by the sampler.
+func (l *Logger) write(lvl Level, msg string, kv []interface{}, sample bool) {
+	if lvl < GetLevel() {
+		return
+	}
+	var suppressed uint64
+	if sample {
+		var ok bool
+		if ok, suppressed = sampler.allow(l.component + "\x00" + msg); !ok {
+			return
+		}
+	}
+	b := &bytes.Buffer{}
+	b.WriteString(`{"time":`)
+	writeValue(b, time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":"` + lvl.String() + `","component":`)
+	writeValue(b, l.component)
+	b.WriteString(`,"msg":`)
+	writeValue(b, msg)
+	writeFields(b, l.fields)
+	writeFields(b, kv)
+	if suppressed > 0 {
+		b.WriteString(`,"suppressed":`)
+		writeValue(b, suppressed)
+	}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		b.WriteString(`,"caller":`)
+		writeValue(b, fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line))
+	}
+	b.WriteString("}\n")
+
+	out := stdout
+	if lvl >= Error {
+		out = stderr
+	}
+	outMux.Lock()
+	_, _ = out.Write(b.Bytes())
+	outMux.Unlock()
+}
+
+func writeFields(b *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		b.WriteByte(',')
+		writeValue(b, key)
+		b.WriteByte(':')
+		if i+1 < len(kv) {
+			writeValue(b, kv[i+1])
+		} else {
+			b.WriteString("null")
+		}
+	}
+}
+
+func writeValue(b *bytes.Buffer, v interface{}) {
+	switch t := v.(type) {
+	case error:
+		v = t.Error()
+	case fmt.Stringer:
+		v = t.String()
+	case []byte:
+		v = string(t)
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(j)
+}
+
+// sampling allows the first sampleBurst entries with the same message in each sampleInterval, the rest are counted and
+// reported on the next entry that gets through.
+const (
+	sampleBurst    = 10
+	sampleInterval = time.Minute
+)
+
+type sampleCount struct {
+	start   time.Time
+	count   int
+	dropped uint64
+}
+
+type samples struct {
+	sync.Mutex
+	counts map[string]*sampleCount
+}
+
+var sampler = &samples{counts: make(map[string]*sampleCount)}
+
+func (s *samples) allow(key string) (ok bool, suppressed uint64) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	c := s.counts[key]
+	if c == nil || now.Sub(c.start) >= sampleInterval {
+		if c != nil {
+			suppressed = c.dropped
+		}
+		if len(s.counts) > 10000 {
+			// messages should be constant strings, but don't grow forever if they aren't
+			s.counts = make(map[string]*sampleCount)
+		}
+		s.counts[key] = &sampleCount{start: now, count: 1}
+		return true, suppressed
+	}
+	if c.count < sampleBurst {
+		c.count += 1
+		return true, 0
+	}
+	c.dropped += 1
+	return false, 0
 }
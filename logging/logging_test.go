@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	stdout, stderr = out, out
+	defer SetLevel(Info)
+
+	log := New("test").With("queue", "tx")
+	log.Debug("hidden")
+	log.Info("published", "block_num", uint32(12), "error", errors.New("boom"))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one line at info, got %q", out.String())
+	}
+	entry := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "info" || entry["component"] != "test" || entry["msg"] != "published" ||
+		entry["queue"] != "tx" || entry["block_num"] != 12.0 || entry["error"] != "boom" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if !strings.HasPrefix(entry["caller"].(string), "logging/logging_test.go:") {
+		t.Errorf("unexpected caller %v", entry["caller"])
+	}
+
+	out.Reset()
+	SetLevel(Debug)
+	log.Debug("shown")
+	if out.Len() == 0 {
+		t.Error("debug should be logged after changing the level")
+	}
+
+	out.Reset()
+	for i := 0; i < sampleBurst*2; i++ {
+		log.Warn("repeated")
+	}
+	if n := strings.Count(out.String(), "\n"); n != sampleBurst {
+		t.Errorf("expected %d sampled warnings, got %d", sampleBurst, n)
+	}
+
+	out.Reset()
+	for i := 0; i < sampleBurst*2; i++ {
+		log.Error("repeated error")
+	}
+	if n := strings.Count(out.String(), "\n"); n != sampleBurst {
+		t.Errorf("expected %d sampled errors, got %d", sampleBurst, n)
+	}
+
+	out.Reset()
+	log.Final("repeated error")
+	if !strings.Contains(out.String(), "repeated error") {
+		t.Error("a final error should not be sampled")
+	}
+	if l, err := ParseLevel("WARN"); err != nil || l != Warn {
+		t.Error("could not parse level")
+	}
+}
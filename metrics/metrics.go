@@ -0,0 +1,78 @@
+// Package metrics holds the prometheus metrics describing ingest health, they are served on /metrics.
+package metrics
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	SeenBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fioetl_seen_block",
+		Help: "Last block number seen from chronicle.",
+	})
+	SentBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fioetl_sent_block",
+		Help: "Last block number chronicle reported as completed.",
+	})
+	AckedBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fioetl_acked_block",
+		Help: "Last block number acknowledged to chronicle.",
+	})
+	HeadBlock = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fioetl_head_block",
+		Help: "Chain head block number reported by chronicle.",
+	})
+	BlockLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fioetl_block_lag",
+		Help: "Number of blocks between the chain head and the last completed block.",
+	})
+	Received = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fioetl_messages_received_total",
+		Help: "Messages received from chronicle by msgtype.",
+	}, []string{"msgtype"})
+	TransformErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fioetl_transform_errors_total",
+		Help: "Messages that could not be transformed, by transform function.",
+	}, []string{"transform"})
+	InFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fioetl_in_flight_messages",
+		Help: "Messages currently being transformed or waiting to be published.",
+	})
+	Published = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fioetl_published_total",
+		Help: "Records published by queue.",
+	}, []string{"queue"})
+	PublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fioetl_publish_errors_total",
+		Help: "Failed publishes by queue.",
+	}, []string{"queue"})
+	DeadLetters = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fioetl_dead_letters_total",
+		Help: "Messages stored as dead letters because they could not be transformed.",
+	})
+	BytesProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fioetl_processed_bytes_total",
+		Help: "Bytes received from chronicle.",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "fioetl_heap_inuse_bytes",
+		Help: "Bytes of heap in use, the consumer restarts when this exceeds the configured limit.",
+	}, func() float64 {
+		m := &runtime.MemStats{}
+		runtime.ReadMemStats(m)
+		return float64(m.HeapInuse)
+	})
+)
+
+// Count returns the current value of a counter, for reporting it somewhere other than /metrics.
+func Count(c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,359 @@
+package queue
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ElasticOptions configures the Elasticsearch bulk sink
+type ElasticOptions struct {
+	Url      string
+	User     string
+	Password string
+	// Insecure skips TLS certificate verification, the same as logstash's ssl_certificate_verification => false
+	Insecure bool
+	// BatchSize is the number of documents buffered for an index before it is flushed
+	BatchSize int
+	// FlushInterval is the longest a document will be buffered
+	FlushInterval time.Duration
+}
+
+const (
+	esMaxAttempts = 8
+	esMaxBackoff  = 30 * time.Second
+)
+
+// Elastic returns a Factory that indexes records directly into elasticsearch using the _bulk API. Documents are
+// written to the same indices logstash would use: logstash-<type>-YYYY.MM, with the record id as the document id.
+func Elastic(opts ElasticOptions) Factory {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	opts.Url = strings.TrimRight(opts.Url, "/")
+	return func(channel string) (Publisher, error) {
+		return newElasticPublisher(opts, channel)
+	}
+}
+
+type elasticPublisher struct {
+	opts    ElasticOptions
+	channel string
+	client  *http.Client
+
+	mux     sync.Mutex
+	pending map[string]*esBatch
+	lastErr error
+
+	done chan interface{}
+	wg   sync.WaitGroup
+}
+
+func newElasticPublisher(opts ElasticOptions, channel string) (*elasticPublisher, error) {
+	e := &elasticPublisher{
+		opts:    opts,
+		channel: channel,
+		client: &http.Client{
+			Timeout: 2 * time.Minute,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.Insecure},
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		},
+		pending: make(map[string]*esBatch),
+		done:    make(chan interface{}),
+	}
+	// fail early if the cluster isn't reachable
+	resp, err := e.do(http.MethodGet, "/", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("elasticsearch returned %s", resp.Status)
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		t := time.NewTicker(opts.FlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-e.done:
+				return
+			case <-t.C:
+				if err := e.Flush(); err != nil {
+					log.Error("elasticsearch flush failed", "queue", channel, "error", err)
+				}
+			}
+		}
+	}()
+	return e, nil
+}
+
+// esBatch holds the bulk lines buffered for an index, and the messages they came from
+type esBatch struct {
+	lines [][]byte
+	msgs  []*Message
+}
+
+func (e *elasticPublisher) Publish(msg *Message) error {
+	doc, err := decodeDoc(msg.Body)
+	if err != nil {
+		return err
+	}
+	if doc["type"] == "retract" {
+		// anything still buffered belongs to blocks before the fork and must be written before the delete.
+		if err = e.Flush(); err != nil {
+			return err
+		}
+		if err = e.retract(doc); err != nil {
+			return err
+		}
+		msg.Confirm(nil)
+		return nil
+	}
+
+	index := indexFor(doc)
+	action, err := json.Marshal(map[string]interface{}{
+		"index": map[string]interface{}{"_index": index, "_id": doc["id"]},
+	})
+	if err != nil {
+		return err
+	}
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	batch := e.pending[index]
+	if batch == nil {
+		batch = &esBatch{}
+		e.pending[index] = batch
+	}
+	batch.lines = append(batch.lines, append(append(append(action, '\n'), source...), '\n'))
+	batch.msgs = append(batch.msgs, msg)
+	if len(batch.lines) >= e.opts.BatchSize {
+		return e.flushIndex(index, msg)
+	}
+	return nil
+}
+
+func (e *elasticPublisher) Flush() error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	for index := range e.pending {
+		if err := e.flushIndex(index, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *elasticPublisher) Close() error {
+	close(e.done)
+	e.wg.Wait()
+	return e.Flush()
+}
+
+func (e *elasticPublisher) Health() error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return e.lastErr
+}
+
+// flushIndex sends the buffered documents for one index and confirms them, it must be called with the lock held. If
+// the request fails, inFlight is left for the caller of Publish to confirm when the error is returned to it.
+func (e *elasticPublisher) flushIndex(index string, inFlight *Message) error {
+	batch := e.pending[index]
+	delete(e.pending, index)
+	err := e.bulk(batch.lines)
+	e.lastErr = err
+	for _, m := range batch.msgs {
+		if err != nil && m == inFlight {
+			continue
+		}
+		m.Confirm(err)
+	}
+	return err
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Id     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// bulk sends the action/source line pairs, retrying the whole request on 429 or 5xx and individual items that were
+// rejected with a 429.
+func (e *elasticPublisher) bulk(lines [][]byte) error {
+	backoff := 500 * time.Millisecond
+	for attempt := 1; len(lines) > 0; attempt++ {
+		if attempt > esMaxAttempts {
+			return fmt.Errorf("giving up on %d documents after %d attempts", len(lines), esMaxAttempts)
+		}
+		if attempt > 1 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > esMaxBackoff {
+				backoff = esMaxBackoff
+			}
+		}
+		resp, err := e.do(http.MethodPost, "/_bulk", "application/x-ndjson", bytes.NewReader(bytes.Join(lines, nil)))
+		if err != nil {
+			log.Warn("bulk request failed, retrying", "queue", e.channel, "error", err)
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			log.Warn("reading bulk response failed, retrying", "queue", e.channel, "error", err)
+			continue
+		}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			log.Debug("bulk request rejected, retrying", "queue", e.channel, "status", resp.StatusCode)
+			continue
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("bulk request returned %s: %s", resp.Status, string(body))
+		}
+		br := &bulkResponse{}
+		if err = json.Unmarshal(body, br); err != nil {
+			return err
+		}
+		if !br.Errors {
+			return nil
+		}
+		retry := make([][]byte, 0)
+		for i, item := range br.Items {
+			for _, result := range item {
+				switch {
+				case result.Status == http.StatusTooManyRequests && i < len(lines):
+					retry = append(retry, lines[i])
+				case result.Status >= 300:
+					// same as logstash: a document that is rejected for any other reason is logged and dropped.
+					log.Error("document rejected", "queue", e.channel, "id", result.Id, "status", result.Status, "error", result.Error)
+				}
+			}
+		}
+		lines = retry
+	}
+	return nil
+}
+
+// retract removes documents from the abandoned side of a fork
+func (e *elasticPublisher) retract(doc map[string]interface{}) error {
+	indices, _ := doc["indices"].(string)
+	if indices == "" {
+		return errors.New("retraction did not include indices")
+	}
+	query := fmt.Sprintf(`{"query":{"range":{"block_num":{"gte":%v}}}}`, doc["block_num"])
+	resp, err := e.do(http.MethodPost, "/"+indices+"/_delete_by_query?conflicts=proceed", "application/json", strings.NewReader(query))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("delete by query returned %s: %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+func (e *elasticPublisher) do(method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, e.opts.Url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if e.opts.User != "" {
+		req.SetBasicAuth(e.opts.User, e.opts.Password)
+	}
+	return e.client.Do(req)
+}
+
+// decodeDoc does what the logstash filters did: renames record_type to type, and sets @timestamp from the block time.
+func decodeDoc(msg []byte) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	// keep large integers (like global_sequence) intact
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if rt, ok := doc["record_type"]; ok {
+		doc["type"] = rt
+		delete(doc, "record_type")
+	}
+	for _, field := range []string{"block_timestamp", "block_time"} {
+		if s, ok := doc[field].(string); ok && strings.HasPrefix(s, "2") {
+			if ts, err := parseTime(s); err == nil {
+				doc["@timestamp"] = ts.Format("2006-01-02T15:04:05.000Z07:00")
+				break
+			}
+		}
+	}
+	if doc["@timestamp"] == nil {
+		doc["@timestamp"] = time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	}
+	if kvo, ok := doc["kvo"].(map[string]interface{}); ok {
+		if value, ok := kvo["value"].(map[string]interface{}); ok {
+			// depending on the contract the expiration is unix seconds, possibly as a string, or an ISO time
+			var exp time.Time
+			switch e := value["expiration"].(type) {
+			case json.Number:
+				if i, err := e.Int64(); err == nil {
+					exp = time.Unix(i, 0)
+				}
+			case string:
+				if i, err := strconv.ParseInt(e, 10, 64); err == nil {
+					exp = time.Unix(i, 0)
+				} else if t, err := parseTime(e); err == nil {
+					exp = t
+				}
+			}
+			if !exp.IsZero() {
+				value["expiration_date"] = exp.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+			}
+		}
+	}
+	return doc, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	var err error
+	var t time.Time
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err = time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return t, err
+}
+
+// indexFor gives the monthly index for a document, which has already had @timestamp set
+func indexFor(doc map[string]interface{}) string {
+	month := time.Now().UTC().Format("2006.01")
+	if ts, err := time.Parse(time.RFC3339Nano, doc["@timestamp"].(string)); err == nil {
+		month = ts.Format("2006.01")
+	}
+	return fmt.Sprintf("logstash-%v-%s", doc["type"], month)
+}
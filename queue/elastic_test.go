@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestElasticPublisher(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		attempts int
+		indexed  = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`{"tagline":"You Know, for Search"}`))
+			return
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		attempts += 1
+		if attempts == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		items := make([]string, 0)
+		for scanner.Scan() {
+			action := make(map[string]map[string]string)
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Error(err)
+			}
+			scanner.Scan()
+			indexed[action["index"]["_id"]] = action["index"]["_index"]
+			items = append(items, `{"index":{"status":201}}`)
+		}
+		_, _ = w.Write([]byte(`{"errors":false,"items":[` + strings.Join(items, ",") + `]}`))
+	}))
+	defer srv.Close()
+
+	p, err := Elastic(ElasticOptions{Url: srv.URL, BatchSize: 10, FlushInterval: time.Hour})("tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var confirmed int
+	for _, msg := range []string{
+		`{"id":"abc","record_type":"trace","block_num":123,"block_timestamp":"2020-07-07T03:57:22.500","trace":{}}`,
+		`{"id":"abc-2","record_type":"transfer","block_num":123,"block_timestamp":"2020-07-07T03:57:22.500","txid":"abc"}`,
+	} {
+		m := &Message{Body: []byte(msg), Done: func(err error) {
+			if err == nil {
+				confirmed += 1
+			}
+		}}
+		if err = p.Publish(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// one bulk request per index, plus the retry after the 429
+	if attempts != 3 {
+		t.Errorf("expected a retry after 429, got %d attempts", attempts)
+	}
+	if indexed["abc"] != "logstash-trace-2020.07" {
+		t.Errorf("trace indexed in wrong index: %q", indexed["abc"])
+	}
+	if indexed["abc-2"] != "logstash-transfer-2020.07" {
+		t.Errorf("transfer indexed in wrong index: %v", indexed)
+	}
+	if confirmed != 2 {
+		t.Errorf("expected both records to be confirmed, got %d", confirmed)
+	}
+	if len(indexed) != 2 {
+		t.Errorf("expected two documents, got %v", indexed)
+	}
+}
+
+// TestElasticConfirmsOnce checks every message is confirmed exactly once when a bulk request fails, including the
+// one whose Publish triggered the flush and so gets the error back.
+func TestElasticConfirmsOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`{"tagline":"You Know, for Search"}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p, err := Elastic(ElasticOptions{Url: srv.URL, BatchSize: 2, FlushInterval: time.Hour})("tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirms := make([]int, 3)
+	var failed int
+	for i := range confirms {
+		i := i
+		m := &Message{
+			Body: []byte(`{"id":"abc","record_type":"trace","block_num":123,"block_timestamp":"2020-07-07T03:57:22.500","trace":{}}`),
+			Done: func(err error) {
+				confirms[i] += 1
+			},
+		}
+		// the same as StartProducer, a message that wasn't accepted is confirmed by the caller
+		if err = p.Publish(m); err != nil {
+			failed += 1
+			m.Confirm(err)
+		}
+	}
+	if err = p.Close(); err == nil {
+		t.Error("expected the final flush to fail")
+	}
+	if failed != 1 {
+		t.Errorf("expected the publish that filled the batch to fail, %d did", failed)
+	}
+	for i, n := range confirms {
+		if n != 1 {
+			t.Errorf("message %d was confirmed %d times", i, n)
+		}
+	}
+}
+
+func TestDecodeDocExpiration(t *testing.T) {
+	for _, exp := range []string{`1602547200`, `"1602547200"`, `"2020-10-13T00:00:00"`, `"2020-10-13T00:00:00.000Z"`} {
+		doc, err := decodeDoc([]byte(`{"record_type":"table_row","block_num":1,"kvo":{"value":{"expiration":` + exp + `}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := doc["kvo"].(map[string]interface{})["value"].(map[string]interface{})
+		if value["expiration_date"] != "2020-10-13T00:00:00.000Z" {
+			t.Errorf("expiration %s: got expiration_date %v", exp, value["expiration_date"])
+		}
+	}
+}
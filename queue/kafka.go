@@ -0,0 +1,242 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaOptions configures the Kafka sink
+type KafkaOptions struct {
+	Brokers []string
+	// Version is the kafka protocol version, at least 0.11 is required for the idempotent producer
+	Version string
+	// FlushBytes, FlushMessages, and FlushFrequency control batching, the defaults are sized for catching up at
+	// several thousand blocks per second.
+	FlushBytes     int
+	FlushMessages  int
+	FlushFrequency time.Duration
+}
+
+// Kafka returns a Factory that publishes each stream to a topic named for its queue. Records are keyed by block number,
+// except table rows which are keyed by code/scope/table, so updates to the same row always land on the same partition
+// in order.
+func Kafka(opts KafkaOptions) Factory {
+	if opts.Version == "" {
+		opts.Version = "2.1.0"
+	}
+	if opts.FlushBytes <= 0 {
+		opts.FlushBytes = 1024 * 1024
+	}
+	if opts.FlushMessages <= 0 {
+		opts.FlushMessages = 5000
+	}
+	if opts.FlushFrequency <= 0 {
+		opts.FlushFrequency = 100 * time.Millisecond
+	}
+	return func(channel string) (Publisher, error) {
+		return newKafkaPublisher(opts, channel)
+	}
+}
+
+// kafkaMeta links a producer message back to the record, a record may be sent to several partitions and is only
+// confirmed when all of them have been acknowledged.
+type kafkaMeta struct {
+	msg       *Message
+	remaining int32
+	broadcast bool
+}
+
+func (m *kafkaMeta) ack(err error) {
+	if err != nil {
+		// report the first failure, later results for the same record are ignored
+		if atomic.SwapInt32(&m.remaining, -1) > 0 {
+			m.msg.Confirm(err)
+		}
+		return
+	}
+	if atomic.AddInt32(&m.remaining, -1) == 0 {
+		m.msg.Confirm(nil)
+	}
+}
+
+// kafkaPartitioner hashes the key, except for messages that are sent to every partition
+type kafkaPartitioner struct {
+	hash sarama.Partitioner
+}
+
+func newKafkaPartitioner(topic string) sarama.Partitioner {
+	return &kafkaPartitioner{hash: sarama.NewHashPartitioner(topic)}
+}
+
+func (k *kafkaPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if meta, ok := msg.Metadata.(*kafkaMeta); ok && meta.broadcast {
+		return msg.Partition, nil
+	}
+	return k.hash.Partition(msg, numPartitions)
+}
+
+func (k *kafkaPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+type kafkaPublisher struct {
+	topic    string
+	client   sarama.Client
+	producer sarama.AsyncProducer
+
+	inFlight sync.WaitGroup
+	mux      sync.Mutex
+	lastErr  error
+	done     chan interface{}
+}
+
+func newKafkaPublisher(opts KafkaOptions, topic string) (*kafkaPublisher, error) {
+	version, err := sarama.ParseKafkaVersion(opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	conf := sarama.NewConfig()
+	conf.ClientID = "fioetl"
+	conf.Version = version
+	conf.Producer.Idempotent = true
+	conf.Producer.RequiredAcks = sarama.WaitForAll
+	conf.Producer.Retry.Max = 10
+	conf.Producer.Retry.Backoff = 250 * time.Millisecond
+	conf.Producer.Return.Successes = true
+	conf.Producer.Return.Errors = true
+	conf.Producer.Compression = sarama.CompressionLZ4
+	conf.Producer.Flush.Bytes = opts.FlushBytes
+	conf.Producer.Flush.Messages = opts.FlushMessages
+	conf.Producer.Flush.Frequency = opts.FlushFrequency
+	conf.Producer.Partitioner = newKafkaPartitioner
+	conf.ChannelBufferSize = 4096
+	// the idempotent producer only guarantees ordering with a single in-flight request per broker
+	conf.Net.MaxOpenRequests = 1
+
+	client, err := sarama.NewClient(opts.Brokers, conf)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return startKafkaPublisher(topic, client, producer), nil
+}
+
+// startKafkaPublisher matches the producer's results to the records they came from
+func startKafkaPublisher(topic string, client sarama.Client, producer sarama.AsyncProducer) *kafkaPublisher {
+	k := &kafkaPublisher{
+		topic:    topic,
+		client:   client,
+		producer: producer,
+		done:     make(chan interface{}),
+	}
+	go func() {
+		for m := range producer.Successes() {
+			// the broker is accepting messages again, an earlier error no longer makes the publisher unhealthy
+			k.mux.Lock()
+			k.lastErr = nil
+			k.mux.Unlock()
+			m.Metadata.(*kafkaMeta).ack(nil)
+			k.inFlight.Done()
+		}
+	}()
+	go func() {
+		defer close(k.done)
+		for e := range producer.Errors() {
+			log.Error("kafka producer error", "queue", topic, "error", e.Err)
+			k.mux.Lock()
+			k.lastErr = e.Err
+			k.mux.Unlock()
+			e.Msg.Metadata.(*kafkaMeta).ack(e.Err)
+			k.inFlight.Done()
+		}
+	}()
+	return k
+}
+
+// kafkaKey is the part of a record used for the partition key
+type kafkaKey struct {
+	RecordType string      `json:"record_type"`
+	BlockNum   json.Number `json:"block_num"`
+	Kvo        *struct {
+		Code  string `json:"code"`
+		Scope string `json:"scope"`
+		Table string `json:"table"`
+	} `json:"kvo"`
+}
+
+func (k *kafkaPublisher) Publish(msg *Message) error {
+	if err := k.Health(); err != nil {
+		return err
+	}
+	key := &kafkaKey{}
+	if err := json.Unmarshal(msg.Body, key); err != nil {
+		return err
+	}
+	if key.RecordType == "retract" {
+		// a retraction has to be ordered with the records it removes, which may be on any partition.
+		partitions, err := k.client.Partitions(k.topic)
+		if err != nil {
+			return err
+		}
+		meta := &kafkaMeta{msg: msg, remaining: int32(len(partitions)), broadcast: true}
+		for _, p := range partitions {
+			k.send(&sarama.ProducerMessage{
+				Topic:     k.topic,
+				Partition: p,
+				Metadata:  meta,
+				Value:     sarama.ByteEncoder(msg.Body),
+			})
+		}
+		return nil
+	}
+	pk := string(key.BlockNum)
+	if key.Kvo != nil {
+		pk = key.Kvo.Code + "/" + key.Kvo.Scope + "/" + key.Kvo.Table
+	}
+	k.send(&sarama.ProducerMessage{
+		Topic:    k.topic,
+		Key:      sarama.StringEncoder(pk),
+		Value:    sarama.ByteEncoder(msg.Body),
+		Metadata: &kafkaMeta{msg: msg, remaining: 1},
+	})
+	return nil
+}
+
+func (k *kafkaPublisher) send(msg *sarama.ProducerMessage) {
+	k.inFlight.Add(1)
+	k.producer.Input() <- msg
+}
+
+// Flush waits until the broker has acknowledged every message sent so far.
+func (k *kafkaPublisher) Flush() error {
+	k.inFlight.Wait()
+	return k.Health()
+}
+
+func (k *kafkaPublisher) Close() error {
+	err := k.Flush()
+	k.producer.AsyncClose()
+	<-k.done
+	if e := k.client.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (k *kafkaPublisher) Health() error {
+	if k.client.Closed() {
+		return errors.New(k.topic + ": kafka client is closed")
+	}
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return k.lastErr
+}
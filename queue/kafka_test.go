@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+// kafkaClient stands in for the cluster metadata, the publisher only asks it for partitions
+type kafkaClient struct {
+	sarama.Client
+	partitions []int32
+}
+
+func (c *kafkaClient) Partitions(topic string) ([]int32, error) { return c.partitions, nil }
+func (c *kafkaClient) Closed() bool                             { return false }
+func (c *kafkaClient) Close() error                             { return nil }
+
+// sentProducer records every message before handing it to the mock producer, which doesn't expose them.
+type sentProducer struct {
+	*mocks.AsyncProducer
+	input chan *sarama.ProducerMessage
+	mux   sync.Mutex
+	sent  []*sarama.ProducerMessage
+}
+
+func newSentProducer(t *testing.T) *sentProducer {
+	conf := mocks.NewTestConfig()
+	conf.Producer.Return.Successes = true
+	conf.Producer.Return.Errors = true
+	p := &sentProducer{
+		AsyncProducer: mocks.NewAsyncProducer(t, conf),
+		input:         make(chan *sarama.ProducerMessage),
+	}
+	go func() {
+		for m := range p.input {
+			p.mux.Lock()
+			p.sent = append(p.sent, m)
+			p.mux.Unlock()
+			p.AsyncProducer.Input() <- m
+		}
+		p.AsyncProducer.AsyncClose()
+	}()
+	return p
+}
+
+func (p *sentProducer) Input() chan<- *sarama.ProducerMessage { return p.input }
+func (p *sentProducer) AsyncClose()                           { close(p.input) }
+
+func (p *sentProducer) messages() []*sarama.ProducerMessage {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]*sarama.ProducerMessage{}, p.sent...)
+}
+
+func TestKafkaKeys(t *testing.T) {
+	producer := newSentProducer(t)
+	k := startKafkaPublisher("row", &kafkaClient{partitions: []int32{0, 1, 2}}, producer)
+	var confirmed int
+	for _, msg := range []string{
+		`{"id":"1","record_type":"block","block_num":123}`,
+		`{"id":"2","record_type":"trace","block_num":"124"}`,
+		`{"id":"3","record_type":"table_row","block_num":125,"kvo":{"code":"fio.token","scope":"alice","table":"accounts"}}`,
+	} {
+		producer.ExpectInputAndSucceed()
+		m := &Message{Body: []byte(msg), Done: func(err error) {
+			if err == nil {
+				confirmed += 1
+			}
+		}}
+		if err := k.Publish(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if confirmed != 3 {
+		t.Errorf("expected every record to be confirmed, got %d", confirmed)
+	}
+	sent := producer.messages()
+	if len(sent) != 3 {
+		t.Fatalf("expected three messages, got %d", len(sent))
+	}
+	for i, key := range []string{"123", "124", "fio.token/alice/accounts"} {
+		if got, _ := sent[i].Key.Encode(); string(got) != key {
+			t.Errorf("message %d: expected key %q, got %q", i, key, got)
+		}
+	}
+}
+
+// TestKafkaRetract checks a retraction goes to every partition, and is only confirmed once all of them accepted it.
+func TestKafkaRetract(t *testing.T) {
+	producer := newSentProducer(t)
+	k := startKafkaPublisher("row", &kafkaClient{partitions: []int32{0, 1, 2}}, producer)
+	var confirms []error
+	m := &Message{Body: []byte(`{"record_type":"retract","block_num":123}`), Done: func(err error) {
+		confirms = append(confirms, err)
+	}}
+	for range []int32{0, 1, 2} {
+		producer.ExpectInputAndSucceed()
+	}
+	if err := k.Publish(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(confirms) != 1 || confirms[0] != nil {
+		t.Errorf("expected the retraction to be confirmed once, got %v", confirms)
+	}
+	sent := producer.messages()
+	if len(sent) != 3 {
+		t.Fatalf("expected the retraction on three partitions, got %d messages", len(sent))
+	}
+	partitioner := newKafkaPartitioner("row")
+	for i, msg := range sent {
+		if msg.Partition != int32(i) {
+			t.Errorf("message %d: expected partition %d, got %d", i, i, msg.Partition)
+		}
+		if p, err := partitioner.Partition(msg, 3); err != nil || p != msg.Partition {
+			t.Errorf("message %d: partitioner moved it to %d (%v)", i, p, err)
+		}
+	}
+}
+
+// TestKafkaPublishAfterError checks a failed record is confirmed with the broker's error, and later records are
+// refused until the producer succeeds again.
+func TestKafkaPublishAfterError(t *testing.T) {
+	producer := newSentProducer(t)
+	k := startKafkaPublisher("row", &kafkaClient{partitions: []int32{0}}, producer)
+	brokerErr := errors.New("not enough replicas")
+	producer.ExpectInputAndFail(brokerErr)
+	var confirmed error
+	m := &Message{Body: []byte(`{"record_type":"block","block_num":123}`), Done: func(err error) {
+		confirmed = err
+	}}
+	if err := k.Publish(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Flush(); err != brokerErr {
+		t.Errorf("expected the flush to return the broker error, got %v", err)
+	}
+	if confirmed != brokerErr {
+		t.Errorf("expected the record to be confirmed with the broker error, got %v", confirmed)
+	}
+	if err := k.Publish(&Message{Body: []byte(`{"record_type":"block","block_num":124}`)}); err != brokerErr {
+		t.Errorf("expected publish to be refused with the broker error, got %v", err)
+	}
+	if len(producer.messages()) != 1 {
+		t.Error("the refused record was sent")
+	}
+	if err := k.Close(); err != brokerErr {
+		t.Errorf("expected close to report the broker error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fioprotocol/fio.etl/metrics"
+	"time"
+)
+
+// Message is a record to publish along with the block it came from.
+type Message struct {
+	BlockNum uint32
+	Body     []byte
+	// Done is called once the sink has durably accepted the record, or with an error if it was lost. It may be nil.
+	Done func(error)
+}
+
+// Confirm calls Done if it is set
+func (m *Message) Confirm(err error) {
+	if m.Done != nil {
+		m.Done(err)
+	}
+}
+
+// Publisher is an output sink for one stream of transformed records, the consumer uses one for each of the block,
+// tx, row, misc, and transfer streams.
+type Publisher interface {
+	// Publish sends a single record, it may be buffered until the next Flush. Once Publish returns nil the publisher
+	// is responsible for confirming the message, if it returns an error the message was not accepted and the caller
+	// confirms it.
+	Publish(msg *Message) error
+	// Flush blocks until every record published so far has been confirmed.
+	Flush() error
+	// Close flushes and releases any connections.
+	Close() error
+	// Health returns nil if the sink is connected and accepting records.
+	Health() error
+}
+
+// Failer is implemented by publishers that can fail between publishes, for example by giving up on reconnecting.
+// Failed is closed once the publisher can't accept records any more, Health then reports why.
+type Failer interface {
+	Failed() <-chan interface{}
+}
+
+// Factory connects a Publisher for the named stream.
+type Factory func(channel string) (Publisher, error)
+
+// StartProducer publishes each record arriving over the messages channel until the context is cancelled or the
+// publisher fails, in either case it closes quit. Cancelling the context is a request to drain: any records already in
+// the channel are published and the publisher is flushed before closing it. After a failure the producer keeps reading
+// the channel until the context is cancelled, confirming each record with the error.
+func StartProducer(ctx context.Context, pub Publisher, channel string, messages chan *Message, errs chan error, quit chan interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("producer panicked", "queue", channel, "panic", fmt.Sprint(r))
+			err := errors.New(fmt.Sprintf("%v", r))
+			errs <- err
+			close(quit)
+			discard(ctx, messages, err)
+		}
+	}()
+	defer pub.Close()
+
+	publish := func(m *Message) error {
+		if m == nil {
+			return nil
+		}
+		if len(m.Body) == 0 {
+			m.Confirm(nil)
+			return nil
+		}
+		if err := pub.Publish(m); err != nil {
+			metrics.PublishErrors.WithLabelValues(channel).Inc()
+			m.Confirm(err)
+			return err
+		}
+		metrics.Published.WithLabelValues(channel).Inc()
+		return nil
+	}
+
+	// a nil channel never fires for publishers that only fail when publishing
+	var failed <-chan interface{}
+	if f, ok := pub.(Failer); ok {
+		failed = f.Failed()
+	}
+
+	printTick := time.NewTicker(30 * time.Second)
+	var sent uint64
+	for {
+		select {
+		case <-ctx.Done():
+			// the consumer has stopped sending, but anything still buffered in the channel needs to go out.
+			for len(messages) > 0 {
+				if err := publish(<-messages); err != nil {
+					log.Error("publishing on exit", "queue", channel, "error", err)
+					break
+				}
+			}
+			if err := pub.Flush(); err != nil {
+				log.Error("flushing on exit", "queue", channel, "error", err)
+			}
+			close(quit)
+			return
+		case <-printTick.C:
+			log.Debug("producer progress", "queue", channel, "sent", sent)
+		case <-failed:
+			err := pub.Health()
+			if err == nil {
+				err = errors.New(channel + ": publisher failed")
+			}
+			log.Error("publisher failed, stopping producer", "queue", channel, "error", err)
+			close(quit)
+			discard(ctx, messages, err)
+			return
+		case m := <-messages:
+			if err := publish(m); err != nil {
+				log.Error("publishing failed, stopping producer", "queue", channel, "error", err)
+				close(quit)
+				discard(ctx, messages, err)
+				return
+			}
+			sent += 1
+		}
+	}
+}
+
+// discard confirms every record still sent to a producer that has stopped as failed with err, until ctx is done, so
+// the consumer is never left blocked handing records to a producer that won't read them.
+func discard(ctx context.Context, messages chan *Message, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			for len(messages) > 0 {
+				if m := <-messages; m != nil {
+					m.Confirm(err)
+				}
+			}
+			return
+		case m := <-messages:
+			if m != nil {
+				m.Confirm(err)
+			}
+		}
+	}
+}
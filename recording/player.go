@@ -0,0 +1,237 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// PlayerOptions configures a mock chronicle
+type PlayerOptions struct {
+	// Url is fioetl's chronicle websocket, for example ws://127.0.0.1:8844/chronicle
+	Url string
+	// Start is the first block sent, 0 for the beginning of the recording. Ignored when interactive.
+	Start uint32
+	// MaxUnacked pauses sending while this many blocks are unacknowledged, like chronicle's exp-ws-max-unack.
+	MaxUnacked uint32
+	// Interactive waits for block ranges to be requested, like chronicle's interactive mode.
+	Interactive bool
+	// AckTimeout is how long to wait for the final acknowledgment once the recording has been sent.
+	AckTimeout time.Duration
+}
+
+// Stats describe a finished playback
+type Stats struct {
+	Messages int
+	Bytes    int
+	Blocks   int
+	// Completed is the last block chronicle would have reported with BLOCK_COMPLETED
+	Completed uint32
+	Acked     uint32
+	Elapsed   time.Duration
+}
+
+var (
+	rangeRequest = regexp.MustCompile(`^(\d+)-(\d+)$`)
+	// chronicle always writes the msgtype first, which saves decoding every message
+	blockCompleted = []byte(`{"msgtype":"BLOCK_COMPLETED"`)
+)
+
+// Player streams a recording to fioetl the way chronicle would: it connects to fioetl, sends the recorded messages,
+// and honors acknowledgments and, in interactive mode, block range requests.
+type Player struct {
+	opts PlayerOptions
+	rec  *Reader
+	ws   *websocket.Conn
+
+	mux   sync.Mutex
+	cond  *sync.Cond
+	acked uint32
+	// base is the block before the first one sent, chronicle starts after the last acknowledged block
+	base     int64
+	requests []uint32
+	err      error
+}
+
+func NewPlayer(rec *Reader, opts PlayerOptions) *Player {
+	if opts.MaxUnacked == 0 {
+		opts.MaxUnacked = 1000
+	}
+	if opts.AckTimeout == 0 {
+		opts.AckTimeout = time.Minute
+	}
+	p := &Player{opts: opts, rec: rec}
+	p.cond = sync.NewCond(&p.mux)
+	return p
+}
+
+// Play sends the recording, or the requested ranges when interactive, until ctx is done. When not interactive it
+// returns once the whole recording has been sent and acknowledged.
+func (p *Player) Play(ctx context.Context) (stats Stats, err error) {
+	start := time.Now()
+	p.ws, _, err = websocket.DefaultDialer.DialContext(ctx, p.opts.Url, nil)
+	if err != nil {
+		return
+	}
+	stop := make(chan interface{})
+	defer func() {
+		close(stop)
+		stats.Acked = p.acknowledged()
+		stats.Elapsed = time.Since(start)
+		p.ws.Close()
+	}()
+	go p.read()
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.fail(ctx.Err())
+		case <-stop:
+		}
+	}()
+
+	if p.opts.Interactive {
+		for {
+			first, last, err := p.nextRequest()
+			if err != nil {
+				return stats, err
+			}
+			if err = p.send(first, last, &stats); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if err = p.send(p.opts.Start, 0, &stats); err != nil {
+		return
+	}
+	err = p.waitForAck(int64(stats.Completed), time.Now().Add(p.opts.AckTimeout))
+	_ = p.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return
+}
+
+// send streams messages from block first through last, 0 is the end of the recording
+func (p *Player) send(first, last uint32, stats *Stats) error {
+	if err := p.rec.Seek(first); err != nil {
+		return err
+	}
+	var block uint32
+	for {
+		m, err := p.rec.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if last != 0 && m.BlockNum > last {
+			return nil
+		}
+		if block == 0 {
+			p.mux.Lock()
+			p.base = int64(m.BlockNum) - 1
+			p.mux.Unlock()
+		}
+		if m.BlockNum != block {
+			// like chronicle, wait at block boundaries while too far ahead of fioetl
+			if err = p.waitForAck(int64(m.BlockNum)-int64(p.opts.MaxUnacked), time.Time{}); err != nil {
+				return err
+			}
+			block = m.BlockNum
+			stats.Blocks += 1
+		}
+		if bytes.HasPrefix(m.Data, blockCompleted) {
+			stats.Completed = m.BlockNum
+		}
+		if err = p.ws.WriteMessage(websocket.BinaryMessage, m.Data); err != nil {
+			return err
+		}
+		stats.Messages += 1
+		stats.Bytes += len(m.Data)
+	}
+}
+
+// read handles what fioetl sends: an acknowledged block number or, in interactive mode, a block range "start-end".
+func (p *Player) read() {
+	for {
+		_, msg, err := p.ws.ReadMessage()
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		s := string(msg)
+		if m := rangeRequest.FindStringSubmatch(s); m != nil {
+			first, _ := strconv.ParseUint(m[1], 10, 32)
+			last, _ := strconv.ParseUint(m[2], 10, 32)
+			p.mux.Lock()
+			p.requests = append(p.requests, uint32(first), uint32(last))
+			p.mux.Unlock()
+			p.cond.Broadcast()
+			continue
+		}
+		acked, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			p.fail(fmt.Errorf("unexpected message from fioetl: %q", s))
+			return
+		}
+		p.mux.Lock()
+		if uint32(acked) > p.acked {
+			p.acked = uint32(acked)
+		}
+		p.mux.Unlock()
+		p.cond.Broadcast()
+	}
+}
+
+func (p *Player) fail(err error) {
+	p.mux.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mux.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *Player) acknowledged() uint32 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.acked
+}
+
+// waitForAck blocks until bn has been acknowledged, a zero deadline waits until the connection fails.
+func (p *Player) waitForAck(bn int64, deadline time.Time) error {
+	if !deadline.IsZero() {
+		timer := time.AfterFunc(time.Until(deadline), func() {
+			p.fail(errors.New("timed out waiting for acknowledgment"))
+		})
+		defer timer.Stop()
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	// acks are not sent in interactive mode
+	for !p.opts.Interactive && int64(p.acked) < bn && p.base < bn && p.err == nil {
+		p.cond.Wait()
+	}
+	return p.err
+}
+
+func (p *Player) nextRequest() (first, last uint32, err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for len(p.requests) == 0 && p.err == nil {
+		p.cond.Wait()
+	}
+	if p.err != nil {
+		return 0, 0, p.err
+	}
+	first, last = p.requests[0], p.requests[1]
+	p.requests = p.requests[2:]
+	return
+}
@@ -0,0 +1,246 @@
+// Package recording stores raw chronicle messages so a session can be played back to fioetl without a FIO node.
+//
+// A recording is a series of gzip members, each holding a chunk of consecutive messages framed as a 4 byte block
+// number, a 4 byte length and the message, all big endian. Gzip readers treat the members as one stream, and because
+// each member can also be decompressed on its own, the index file next to the recording (path + ".idx") lets a
+// reader start at any block. Each line of the index is the first block of a chunk and its byte offset.
+package recording
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// chunkSize is the amount of uncompressed data in a chunk before a new one is started, it is the most a reader has to
+// skip to reach a block.
+const chunkSize = 1024 * 1024
+
+// Message is one message as chronicle sent it
+type Message struct {
+	BlockNum uint32
+	Data     []byte
+}
+
+type indexEntry struct {
+	block  uint32
+	offset int64
+}
+
+// Writer appends messages to a recording, a recording that already exists is added to.
+type Writer struct {
+	mux    sync.Mutex
+	file   *os.File
+	index  *os.File
+	offset int64
+	gz     *gzip.Writer
+	size   int
+	block  uint32
+	closed bool
+}
+
+func Create(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	index, err := os.OpenFile(path+".idx", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Writer{file: file, index: index, offset: info.Size()}, nil
+}
+
+// Write adds a message, chunks only end between blocks so a block is never split across two of them.
+func (w *Writer) Write(bn uint32, data []byte) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return errors.New("recording is closed")
+	}
+	if w.gz != nil && w.size >= chunkSize && bn != w.block {
+		if err := w.endChunk(); err != nil {
+			return err
+		}
+	}
+	if w.gz == nil {
+		if _, err := fmt.Fprintf(w.index, "%d %d\n", bn, w.offset); err != nil {
+			return err
+		}
+		w.gz = gzip.NewWriter(&counter{w: w.file, n: &w.offset})
+		w.size = 0
+	}
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, bn)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	if _, err := w.gz.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.gz.Write(data); err != nil {
+		return err
+	}
+	w.size += len(header) + len(data)
+	w.block = bn
+	return nil
+}
+
+func (w *Writer) endChunk() error {
+	err := w.gz.Close()
+	w.gz = nil
+	return err
+}
+
+// Close finishes the current chunk, messages that haven't been closed are not readable.
+func (w *Writer) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	var err error
+	if w.gz != nil {
+		err = w.endChunk()
+	}
+	if e := w.index.Close(); err == nil {
+		err = e
+	}
+	if e := w.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// counter tracks the offset in the recording, so the index knows where the next chunk starts
+type counter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// Reader reads the messages in a recording in the order they were received.
+type Reader struct {
+	file  *os.File
+	index []indexEntry
+	gz    *gzip.Reader
+	r     *bufio.Reader
+	from  uint32
+}
+
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{file: file}
+	if r.index, err = readIndex(path + ".idx"); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err = r.reset(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func readIndex(path string) ([]indexEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// the index is only needed to seek
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	index := make([]indexEntry, 0)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		e := indexEntry{}
+		if _, err = fmt.Sscanf(scanner.Text(), "%d %d", &e.block, &e.offset); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		index = append(index, e)
+	}
+	return index, scanner.Err()
+}
+
+func (r *Reader) reset(offset int64) error {
+	if _, err := r.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r.r = bufio.NewReader(r.file)
+	var err error
+	if r.gz == nil {
+		r.gz, err = gzip.NewReader(r.r)
+	} else {
+		err = r.gz.Reset(r.r)
+	}
+	if err == io.EOF {
+		// an empty recording
+		err = nil
+	}
+	return err
+}
+
+// Seek positions the reader so Next returns the first message at or after block bn. Chronicle restarts from an
+// earlier block after a fork, so if bn was recorded more than once Seek goes to the last time it was.
+func (r *Reader) Seek(bn uint32) error {
+	var offset int64
+	for _, e := range r.index {
+		if e.block <= bn {
+			offset = e.offset
+		}
+	}
+	r.from = bn
+	return r.reset(offset)
+}
+
+// Next returns the next message, io.EOF at the end of the recording.
+func (r *Reader) Next() (*Message, error) {
+	if r.gz == nil {
+		return nil, io.EOF
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r.gz, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("recording is truncated: %v", err)
+			}
+			return nil, err
+		}
+		m := &Message{
+			BlockNum: binary.BigEndian.Uint32(header),
+			Data:     make([]byte, binary.BigEndian.Uint32(header[4:])),
+		}
+		if _, err := io.ReadFull(r.gz, m.Data); err != nil {
+			return nil, fmt.Errorf("recording is truncated: %v", err)
+		}
+		if m.BlockNum < r.from {
+			continue
+		}
+		r.from = 0
+		return m, nil
+	}
+}
+
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
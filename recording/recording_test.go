@@ -0,0 +1,151 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// record writes blocks first through last, each with a large message so the recording has several chunks
+func record(t *testing.T, first, last uint32) string {
+	dir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "chronicle.rec")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := strings.Repeat("x", 100*1024)
+	for bn := first; bn <= last; bn++ {
+		if err = w.Write(bn, []byte(fmt.Sprintf(`{"msgtype":"TX_TRACE","data":{"block_num":"%d","pad":"%s"}}`, bn, padding))); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write(bn, []byte(fmt.Sprintf(`{"msgtype":"BLOCK_COMPLETED","data":{"block_num":"%d"}}`, bn))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecording(t *testing.T) {
+	path := record(t, 1, 50)
+	// appending starts a new chunk
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(51, []byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.index) < 4 {
+		t.Fatalf("expected several chunks, got %d", len(r.index))
+	}
+	count := 0
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if count == 101 && string(m.Data) != "last" {
+			t.Errorf("expected the appended message last, got block %d", m.BlockNum)
+		}
+	}
+	if count != 101 {
+		t.Errorf("expected 101 messages, read %d", count)
+	}
+	if err = r.Seek(37); err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BlockNum != 37 || !strings.HasPrefix(string(m.Data), `{"msgtype":"TX_TRACE"`) {
+		t.Errorf("seek should start at the first message of block 37, got %d", m.BlockNum)
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	r, err := Open(record(t, 10, 40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// acks every completed block, and checks the player never gets more than 5 blocks ahead
+	received := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		count := 0
+		// the player starts at block 20, as chronicle would after an ack of 19
+		var acked uint64 = 19
+		for {
+			_, d, err := ws.ReadMessage()
+			if err != nil {
+				received <- count
+				return
+			}
+			count++
+			if !strings.HasPrefix(string(d), string(blockCompleted)) {
+				continue
+			}
+			bn, _ := strconv.ParseUint(strings.Split(string(d), `"`)[9], 10, 32)
+			if bn > acked+5 {
+				t.Errorf("block %d was sent with only %d acknowledged", bn, acked)
+			}
+			acked = bn
+			_ = ws.WriteMessage(websocket.TextMessage, []byte(strconv.FormatUint(acked, 10)))
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p := NewPlayer(r, PlayerOptions{
+		Url:        "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Start:      20,
+		MaxUnacked: 5,
+	})
+	stats, err := p.Play(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blocks != 21 || stats.Messages != 42 || stats.Completed != 40 || stats.Acked != 40 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if n := <-received; n != 42 {
+		t.Errorf("server received %d messages", n)
+	}
+}
@@ -5,8 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -34,22 +40,32 @@ func Abi(b []byte) (abi json.RawMessage, err error) {
 	h := sha256.New()
 	h.Write(a.Abi)
 	a.Id = hex.EncodeToString(h.Sum(nil))
-	a.BlockNum, _ = strconv.ParseUint(a.BlockNum.(string), 10, 32)
+	bn, _ := strconv.ParseUint(a.BlockNum.(string), 10, 32)
+	a.BlockNum = bn
 	a.RecordType = "abi"
-	abis.add(a.Account, a.Abi)
+	abis.add(a.Account, uint32(bn), a.Abi)
 	abi, err = json.Marshal(a)
 	return
 }
 
+// abiVersion is an ABI and the block it became active in
+type abiVersion struct {
+	block uint32
+	abi   *eos.ABI
+}
+
+// abiMap keeps every version of each account's ABI, ordered by block, so records from re-indexed ranges are decoded
+// with the ABI that was in force at the time.
 type abiMap struct {
-	abi map[string]*eos.ABI
+	abi map[string][]abiVersion
+	// dir is where learned ABIs are saved, empty if they aren't
+	dir string
 	sync.RWMutex
 }
 
 func newAbiMap() (*abiMap, error) {
-	var err error
 	a := &abiMap{}
-	a.abi = make(map[string]*eos.ABI)
+	a.abi = make(map[string][]abiVersion)
 	for k, v := range map[string][]byte{
 		"eosio":        eosioAbi,
 		"eosio.msig":   eosioMsigAbi,
@@ -60,33 +76,186 @@ func newAbiMap() (*abiMap, error) {
 		"fio.tpid":     fioTpidAbi,
 		"fio.treasury": fioTreasuryAbi,
 	} {
-		a.abi[k], err = eos.NewABI(bytes.NewReader(v))
+		abi, err := eos.NewABI(bytes.NewReader(v))
 		if err != nil {
 			return nil, err
 		}
+		a.abi[k] = []abiVersion{{block: 0, abi: abi}}
 	}
 	return a, nil
 }
 
-func (a *abiMap) add(account string, abi []byte) {
+// add stores an ABI that became active at block, saving it if a directory is configured.
+func (a *abiMap) add(account string, block uint32, abi []byte) {
+	if err := a.put(account, block, abi); err != nil {
+		log.Error("adding new ABI", "account", account, "block_num", block, "error", err)
+		return
+	}
+	a.RLock()
+	dir := a.dir
+	a.RUnlock()
+	if dir == "" {
+		return
+	}
+	if err := saveAbi(dir, account, block, abi); err != nil {
+		log.Error("saving ABI", "account", account, "block_num", block, "dir", dir, "error", err)
+	}
+}
+
+// put stores an ABI that became active at block, an ABI already stored for that block is replaced.
+func (a *abiMap) put(account string, block uint32, abi []byte) error {
 	na, err := eos.NewABI(bytes.NewReader(abi))
 	if err != nil {
-		elog.Println("adding new ABI:", err)
-		return
+		return err
 	}
 	a.Lock()
-	a.abi[account] = na
+	defer a.Unlock()
+	versions := a.abi[account]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].block >= block })
+	if i < len(versions) && versions[i].block == block {
+		versions[i].abi = na
+		return nil
+	}
+	versions = append(versions, abiVersion{})
+	copy(versions[i+1:], versions[i:])
+	versions[i] = abiVersion{block: block, abi: na}
+	a.abi[account] = versions
+	return nil
+}
+
+// LoadAbis adds the ABIs in dir to the built-in genesis ABIs, and saves every ABI learned from now on to it so they
+// survive a restart. Files are named account.abi for an ABI in force from genesis, which replaces the built-in one, or
+// account@block.abi for one set at block.
+func LoadAbis(dir string) error {
+	return abis.load(dir)
+}
+
+func (a *abiMap) load(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.abi"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		account, block, err := parseAbiFile(filepath.Base(f))
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if err = a.put(account, block, b); err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+	}
+	a.Lock()
+	a.dir = dir
 	a.Unlock()
+	log.Info("loaded ABIs", "dir", dir, "files", len(files))
+	return nil
 }
 
-func (a abiMap) lookup(account string, table string, s string) json.RawMessage {
+func abiFile(account string, block uint32) string {
+	if block == 0 {
+		return account + ".abi"
+	}
+	return fmt.Sprintf("%s@%d.abi", account, block)
+}
+
+func parseAbiFile(name string) (account string, block uint32, err error) {
+	account = strings.TrimSuffix(name, ".abi")
+	if i := strings.LastIndex(account, "@"); i >= 0 {
+		b, err := strconv.ParseUint(account[i+1:], 10, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid ABI file name %q, expected account@block.abi", name)
+		}
+		account, block = account[:i], uint32(b)
+	}
+	if account == "" {
+		return "", 0, fmt.Errorf("invalid ABI file name %q", name)
+	}
+	return
+}
+
+// saveAbi writes to a temporary file first so a crash never leaves a partial ABI to be loaded
+func saveAbi(dir string, account string, block uint32, abi []byte) error {
+	path := filepath.Join(dir, abiFile(account, block))
+	if err := ioutil.WriteFile(path+".tmp", abi, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// at returns the account's ABI in force at block, nil if none is known
+func (a *abiMap) at(account string, block uint32) *eos.ABI {
+	a.RLock()
+	defer a.RUnlock()
+	versions := a.abi[account]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].block > block })
+	if i == 0 {
+		return nil
+	}
+	return versions[i-1].abi
+}
+
+// decodeAction decodes action data using the ABI in force at block. Numbers are returned as strings, the same way
+// chronicle presents them, so they are cast like any other record.
+func (a *abiMap) decodeAction(account string, action string, data []byte, block uint32) (map[string]interface{}, error) {
+	abi := a.at(account, block)
+	if abi == nil {
+		return nil, fmt.Errorf("no ABI for %s", account)
+	}
+	j, err := abi.DecodeAction(data, eos.ActionName(action))
+	if err != nil {
+		return nil, err
+	}
+	decoded := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	if err = dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return numbersToStrings(decoded).(map[string]interface{}), nil
+}
+
+func numbersToStrings(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		return t.String()
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = numbersToStrings(t[k])
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = numbersToStrings(t[i])
+		}
+	}
+	return v
+}
+
+// AbiAccounts lists the accounts an ABI is known for
+func AbiAccounts() []string {
+	abis.RLock()
+	defer abis.RUnlock()
+	accounts := make([]string, 0, len(abis.abi))
+	for k := range abis.abi {
+		accounts = append(accounts, k)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// lookup decodes a table row chronicle couldn't, using the ABI in force at block
+func (a *abiMap) lookup(account string, table string, s string, block uint32) json.RawMessage {
 	// already json?
 	if s[0] == '{' {
 		return []byte(`"` + s + `"`)
 	}
-	a.RLock()
-	abi := a.abi[account]
-	a.RUnlock()
+	abi := a.at(account, block)
 	if abi == nil {
 		return []byte(`"` + s + `"`)
 	}
@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAbiVersions(t *testing.T) {
+	a, err := newAbiMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := a.at("fio.token", 0)
+	if genesis == nil || a.at("fio.token", 1000) != genesis {
+		t.Fatal("genesis ABIs should be in force from block 0")
+	}
+	abi := func(field string) []byte {
+		return []byte(`{"version":"eosio::abi/1.1","structs":[{"name":"row","base":"","fields":[{"name":"` + field +
+			`","type":"uint64"}]}],"tables":[{"name":"things","index_type":"i64","type":"row"}]}`)
+	}
+	a.add("example", 200, abi("second"))
+	a.add("example", 100, abi("first"))
+
+	// uint64 5, little endian
+	row := "0500000000000000"
+	for _, c := range []struct {
+		block uint32
+		want  string
+	}{
+		{99, `"` + row + `"`},
+		{100, `{"first":5}`},
+		{199, `{"first":5}`},
+		{200, `{"second":5}`},
+		{5000, `{"second":5}`},
+	} {
+		if got := string(a.lookup("example", "things", row, c.block)); got != c.want {
+			t.Errorf("block %d: expected %s, got %s", c.block, c.want, got)
+		}
+	}
+
+	// a block that is seen again, for example when re-indexing, replaces its version
+	a.add("example", 200, abi("third"))
+	if got := string(a.lookup("example", "things", row, 300)); got != `{"third":5}` {
+		t.Errorf("expected the replaced ABI, got %s", got)
+	}
+	if len(a.abi["example"]) != 2 {
+		t.Errorf("expected 2 versions, got %d", len(a.abi["example"]))
+	}
+}
+
+func TestLoadAbis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "abis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	abi := []byte(`{"version":"eosio::abi/1.1","structs":[{"name":"row","base":"","fields":[{"name":"id","type":"uint64"}]}],"tables":[{"name":"things","index_type":"i64","type":"row"}]}`)
+	if err = ioutil.WriteFile(filepath.Join(dir, "fio.token.abi"), abi, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "example@100.abi"), abi, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newAbiMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.abi["fio.token"]) != 1 || a.at("fio.token", 0).TableForName("things") == nil {
+		t.Error("fio.token.abi should replace the genesis ABI")
+	}
+	if a.at("example", 99) != nil || a.at("example", 100) == nil {
+		t.Error("example@100.abi should be in force from block 100")
+	}
+
+	a.add("example", 250, abi)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "example@250.abi"))
+	if err != nil || !bytes.Equal(b, abi) {
+		t.Error("learned ABI was not saved", err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "example@latest.abi"), abi, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.load(dir); err == nil {
+		t.Error("expected an error for an invalid file name")
+	}
+}
@@ -130,14 +130,14 @@ func (b *BlockHeader) BlockID() (string, []ProducerKeyString, error) {
 		if err == nil {
 			e := json.Unmarshal(npb, &newProds)
 			if e != nil {
-				elog.Println(e)
+				log.Error("decoding new producers", "error", e)
 				return "", nil, e
 			}
 			for i, prod := range newProds {
 				// since we get PUB_K1 keys, this will force them to the short format
 				pub, _, err := BadK1SumToPub(prod.BlockSigningKey)
 				if err != nil {
-					elog.Println(err)
+					log.Error("converting block signing key", "producer", prod.AccountName, "error", err)
 					continue
 				}
 				newProds[i].BlockSigningKey = pub.String()
@@ -147,7 +147,7 @@ func (b *BlockHeader) BlockID() (string, []ProducerKeyString, error) {
 				})
 			}
 		} else {
-			elog.Println(err)
+			log.Error("encoding new producers", "error", err)
 			return "", nil, err
 		}
 		// has to be in order, remember we came from a map...
@@ -202,20 +202,21 @@ func Block(b []byte, fallbackUrl string) (header json.RawMessage, schedule json.
 	block.BlockId, optProducers, err = block.Block.BlockHeader.BlockID()
 	if err != nil || block.BlockId == "" {
 		func() {
-			elog.Printf("ERROR: did not get block id, falling back to api on %s to get block id\n", fallbackUrl)
+			blog := log.With("block_num", block.BlockNum, "fallback_url", fallbackUrl)
+			blog.Warn("did not get block id, falling back to api")
 			api, _, err := fio.NewConnection(nil, fallbackUrl)
 			if err != nil {
-				elog.Println(err)
+				blog.Error("connecting to fallback api", "error", err)
 				return
 			}
 			gbn, err := api.GetBlockByNum(block.BlockNum.(uint32))
 			if err != nil {
-				elog.Println(err)
+				blog.Error("getting block from fallback api", "error", err)
 				return
 			}
 			bid, err := gbn.BlockID()
 			if err != nil {
-				elog.Println(err)
+				blog.Error("getting block id from fallback api", "error", err)
 				return
 			}
 			block.BlockId = bid.String()
@@ -223,13 +224,11 @@ func Block(b []byte, fallbackUrl string) (header json.RawMessage, schedule json.
 	}
 	if block.BlockId == "" {
 		block.BlockId = fmt.Sprintf("block-id-error-%v", block.BlockNum)
-		elog.Println("ERROR: could not derive a block ID for block ", block.BlockNum)
+		log.Error("could not derive a block id", "block_num", block.BlockNum)
 	}
 	block.BlockTime = block.Block.BlockHeader.Timestamp.Time
 	for _, trx := range block.Block.Transactions {
-		if s, ok := trx["trx"].(string); ok {
-			trx["trx"] = map[string]string{"bytes": s}
-		}
+		unpackTrx(trx, uint32(block.BlockNum.(int64)))
 		trx = Fixup(trx)
 	}
 	if block.Block.NewProducers != nil {
@@ -246,7 +245,7 @@ func Block(b []byte, fallbackUrl string) (header json.RawMessage, schedule json.
 		}
 		schedule, err = json.Marshal(&sched)
 		if err != nil {
-			elog.Println(err)
+			log.Error("encoding schedule", "block_num", block.BlockNum, "error", err)
 			schedule = nil
 		}
 	}
@@ -284,6 +283,8 @@ func Account(b []byte, kind string) (trace json.RawMessage, err error) {
 
 type BlockFinished struct {
 	Data struct {
-		BlockNum string `json:"block_num"`
+		BlockNum         string `json:"block_num"`
+		Head             string `json:"head"`
+		LastIrreversible string `json:"last_irreversible"`
 	} `json:"data"`
 }
@@ -2,8 +2,8 @@ package transform
 
 import (
 	"encoding/binary"
+	"github.com/fioprotocol/fio-go/eos"
 	"github.com/importcjj/trie-go"
-	"log"
 	"math"
 	"regexp"
 	"strconv"
@@ -140,6 +140,134 @@ func toFloat(v interface{}) interface{} {
 	return v
 }
 
+// overrides are the paths in the static lists below, they are cast as listed whatever type the ABI declares.
+var overrides = func() map[string]bool {
+	o := make(map[string]bool)
+	for _, list := range [][]string{wantBool, wantFloat, wantInt} {
+		for _, path := range list {
+			o[path] = true
+		}
+	}
+	return o
+}()
+
+// fixupAction casts action data by the field types declared in the ABI in force at block. path is where the data is
+// in the record, using the same dotted form as the static lists.
+func fixupAction(account string, action string, data interface{}, path string, block uint32) {
+	abi := abis.at(account, block)
+	if abi == nil {
+		return
+	}
+	if def := abi.ActionForName(eos.ActionName(action)); def != nil {
+		castByAbi(abi, def.Type, path, data)
+	}
+}
+
+// fixupRow casts a table row by the field types declared in the ABI in force at block
+func fixupRow(code string, table string, row interface{}, path string, block uint32) {
+	abi := abis.at(code, block)
+	if abi == nil {
+		return
+	}
+	if def := abi.TableForName(eos.TableName(table)); def != nil {
+		castByAbi(abi, def.Type, path, row)
+	}
+}
+
+// castByAbi casts v, of ABI type typ, returning the new value. Structs and arrays are updated in place.
+func castByAbi(abi *eos.ABI, typ string, path string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	// optional and binary extension fields are cast like any other once present
+	typ = strings.TrimSuffix(strings.TrimSuffix(typ, "$"), "?")
+	for i := 0; i < 8; i++ {
+		resolved, isAlias := abi.TypeNameForNewTypeName(typ)
+		if !isAlias {
+			break
+		}
+		typ = resolved
+	}
+	if strings.HasSuffix(typ, "[]") {
+		if rows, ok := v.([]interface{}); ok {
+			for i := range rows {
+				rows[i] = castByAbi(abi, strings.TrimSuffix(typ, "[]"), path, rows[i])
+			}
+		}
+		return v
+	}
+	if def := abi.StructForName(typ); def != nil {
+		if fields, ok := v.(map[string]interface{}); ok {
+			castStruct(abi, def, path, fields)
+		}
+		return v
+	}
+	if overrides[path] {
+		return v
+	}
+	switch typ {
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "varint32", "varuint32":
+		return castInt(v)
+	case "float32", "float64":
+		return toFloat(v)
+	case "bool":
+		return toBool(v)
+	case "asset":
+		return castAsset(v)
+	}
+	return v
+}
+
+func castStruct(abi *eos.ABI, def *eos.StructDef, path string, fields map[string]interface{}) {
+	if def.Base != "" {
+		if base := abi.StructForName(def.Base); base != nil && base.Name != def.Name {
+			castStruct(abi, base, path, fields)
+		}
+	}
+	for _, f := range def.Fields {
+		if v, ok := fields[f.Name]; ok {
+			fields[f.Name] = castByAbi(abi, f.Type, path+"."+f.Name, v)
+		}
+	}
+}
+
+// castInt is stricter than toInt, values that aren't integers are left alone and so is a uint64 too large for
+// elasticsearch's long.
+func castInt(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return i
+		}
+	case float64:
+		if t == math.Trunc(t) {
+			return int64(t)
+		}
+	}
+	return v
+}
+
+// castAsset splits an asset like "1.000000000 FIO" into its amount, symbol and precision
+func castAsset(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return v
+	}
+	amount, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return v
+	}
+	precision := 0
+	if i := strings.Index(parts[0], "."); i >= 0 {
+		precision = len(parts[0]) - i - 1
+	}
+	return map[string]interface{}{"amount": amount, "symbol": parts[1], "precision": precision}
+}
+
 // BuildTrie creates a trie used to search for type casts, it is slightly faster than trying every possible value.
 func BuildTrie() (intTrie *trie.Trie, floatTrie *trie.Trie, boolTrie *trie.Trie) {
 	intTrie = trie.New()
@@ -157,7 +285,7 @@ func BuildTrie() (intTrie *trie.Trie, floatTrie *trie.Trie, boolTrie *trie.Trie)
 				if !t.Has("/" + strings.Join(leaf[:i+1], "/")) {
 					err = t.Put("/"+strings.Join(leaf[:i+1], "/"), true)
 					if err != nil {
-						elog.Fatal(err)
+						log.Fatal("building cast trie", "error", err)
 					}
 				}
 			}
@@ -172,7 +300,8 @@ func BuildTrie() (intTrie *trie.Trie, floatTrie *trie.Trie, boolTrie *trie.Trie)
 	return
 }
 
-// each of the following slices are converted into a trie, each slice represents a type to cast to.
+// each of the following slices are converted into a trie, each slice represents a type to cast to. Most fields are
+// cast by the type declared in the ABI, these are only needed where the index expects something else.
 var (
 	wantBool = []string{
 		//`trace.scheduled`,
@@ -180,6 +309,9 @@ var (
 	wantFloat = []string{
 		`act.data.quantity`,
 		`data.quantity`,
+		`kvo.value.balance`,
+		`kvo.value.max_supply`,
+		`kvo.value.supply`,
 	}
 	wantInt = []string{
 		`abi_sequence`,
@@ -3,7 +3,10 @@ package transform
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/fioprotocol/fio-go/eos"
 )
 
 func TestBuildTrie(t *testing.T) {
@@ -506,3 +509,68 @@ const traceJson = `{
     1585094781500
   ]
 }`
+
+func TestCastByAbi(t *testing.T) {
+	abi, err := eos.NewABI(strings.NewReader(`{
+  "version": "eosio::abi/1.1",
+  "types": [{"new_type_name": "fio_amount", "type": "int64"}],
+  "structs": [
+    {"name": "base", "base": "", "fields": [{"name": "id", "type": "uint64"}]},
+    {"name": "entry", "base": "", "fields": [{"name": "weight", "type": "float64"}, {"name": "active", "type": "bool"}]},
+    {"name": "row", "base": "base", "fields": [
+      {"name": "amount", "type": "fio_amount"},
+      {"name": "balance", "type": "asset"},
+      {"name": "staked", "type": "asset"},
+      {"name": "huge", "type": "uint64"},
+      {"name": "entries", "type": "entry[]"},
+      {"name": "maybe", "type": "uint32?"},
+      {"name": "owner", "type": "name"}
+    ]}
+  ],
+  "tables": [{"name": "rows", "index_type": "i64", "type": "row"}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := map[string]interface{}{
+		"id":      "42",
+		"amount":  "1000000000",
+		"balance": "12.500000000 FIO",
+		"staked":  "12.500000000 FIO",
+		"huge":    "18446744073709551615",
+		"entries": []interface{}{map[string]interface{}{"weight": "0.5", "active": "true"}},
+		"maybe":   nil,
+		"owner":   "aloha",
+	}
+	castByAbi(abi, "row", "kvo.value", row)
+	if row["id"] != int64(42) || row["amount"] != int64(1000000000) {
+		t.Errorf("integers were not cast: %#v %#v", row["id"], row["amount"])
+	}
+	if b, ok := row["staked"].(map[string]interface{}); !ok || b["amount"] != 12.5 || b["symbol"] != "FIO" || b["precision"] != 9 {
+		t.Errorf("asset was not split: %#v", row["staked"])
+	}
+	// kvo.value.balance is in the static float list, the existing indices map it as a float
+	if Fixup(map[string]interface{}{"kvo": map[string]interface{}{"value": row}}); row["balance"] != 12.5 {
+		t.Errorf("balance should be a float, got %#v", row["balance"])
+	}
+	if row["huge"] != "18446744073709551615" {
+		t.Errorf("a uint64 too large for a long should be left alone, got %#v", row["huge"])
+	}
+	entry := row["entries"].([]interface{})[0].(map[string]interface{})
+	if entry["weight"] != 0.5 || entry["active"] != true {
+		t.Errorf("array of structs was not cast: %#v", entry)
+	}
+	if row["maybe"] != nil || row["owner"] != "aloha" {
+		t.Errorf("unexpected %#v %#v", row["maybe"], row["owner"])
+	}
+
+	// data.amount is in the static int list, so it is left for Fixup
+	data := map[string]interface{}{"amount": "12 FIO", "balance": "1.0 FIO"}
+	castByAbi(abi, "row", "data", data)
+	if data["amount"] != "12 FIO" {
+		t.Errorf("static list should override the ABI, got %#v", data["amount"])
+	}
+	if Fixup(map[string]interface{}{"data": data})["data"].(map[string]interface{})["amount"] != int64(12) {
+		t.Error("Fixup should still cast the overridden field")
+	}
+}
@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ForkEvent is sent by chronicle when the chain switches forks, every block from BlockNum onward is invalid.
+type ForkEvent struct {
+	Data struct {
+		BlockNum         string `json:"block_num"`
+		Depth            string `json:"depth"`
+		ForkReason       string `json:"fork_reason"`
+		LastIrreversible string `json:"last_irreversible"`
+	} `json:"data"`
+}
+
+// Fork parses a FORK message and returns the first block number that is no longer valid.
+func Fork(b []byte) (blockNum uint32, err error) {
+	fe := &ForkEvent{}
+	err = json.Unmarshal(b, fe)
+	if err != nil {
+		return
+	}
+	if fe.Data.BlockNum == "" {
+		return 0, errors.New("fork message did not include a block number")
+	}
+	bn, err := strconv.ParseUint(fe.Data.BlockNum, 10, 32)
+	if err != nil {
+		return
+	}
+	if bn == 0 {
+		return 0, errors.New("invalid fork block number 0")
+	}
+	return uint32(bn), nil
+}
+
+// Retraction tells downstream consumers to delete any record of the listed types with a block_num of BlockNum or
+// higher. It is sent on each queue so that it is ordered with the records it invalidates.
+type Retraction struct {
+	Id         string    `json:"id"`
+	RecordType string    `json:"record_type"`
+	BlockNum   uint32    `json:"block_num"`
+	BlockTime  time.Time `json:"block_time"`
+	Types      []string  `json:"types"`
+	Indices    string    `json:"indices"`
+}
+
+// retractTypes maps each queue to the record types it carries
+var retractTypes = map[string][]string{
+	"block":    {"block", "schedule"},
+	"tx":       {"trace"},
+	"transfer": {"transfer"},
+	"row":      {"table_row"},
+	"misc":     {"abi", "permission", "permission_link", "acc_metadata"},
+}
+
+// Retract builds the retraction record for a queue after a fork at blockNum.
+func Retract(queue string, blockNum uint32) (json.RawMessage, error) {
+	types := retractTypes[queue]
+	if types == nil {
+		return nil, fmt.Errorf("no record types known for queue %s", queue)
+	}
+	indices := make([]string, len(types))
+	for i := range types {
+		indices[i] = "logstash-" + types[i] + "-*"
+	}
+	now := time.Now().UTC()
+	return json.Marshal(&Retraction{
+		Id:         fmt.Sprintf("retract-%s-%d-%d", queue, blockNum, now.UnixNano()),
+		RecordType: "retract",
+		BlockNum:   blockNum,
+		BlockTime:  now,
+		Types:      types,
+		Indices:    strings.Join(indices, ","),
+	})
+}
@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFork(t *testing.T) {
+	bn, err := Fork([]byte(`{"msgtype":"FORK","data":{"block_num":"1234","depth":"2","fork_reason":"network","last_irreversible":"1100"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bn != 1234 {
+		t.Errorf("expected fork at 1234, got %d", bn)
+	}
+	if _, err = Fork([]byte(`{"msgtype":"FORK","data":{}}`)); err == nil {
+		t.Error("expected error for fork without a block number")
+	}
+
+	j, err := Retract("block", bn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Retraction{}
+	if err = json.Unmarshal(j, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.RecordType != "retract" || r.BlockNum != 1234 || r.Indices != "logstash-block-*,logstash-schedule-*" {
+		t.Errorf("unexpected retraction: %s", string(j))
+	}
+	if _, err = Retract("nope", bn); err == nil {
+		t.Error("expected error for unknown queue")
+	}
+}
@@ -1,22 +1,20 @@
 package transform
 
 import (
-	l "github.com/fioprotocol/fio.etl/logging"
-	"log"
+	"github.com/fioprotocol/fio.etl/logging"
 )
 
 var (
 	abis *abiMap
-	elog *log.Logger
+	log  = logging.New("transform")
 )
 
 func init() {
 	var err error
 	abis, err = newAbiMap()
 	if err != nil {
-		log.Fatal("building abi map: ", err)
+		log.Fatal("building abi map", "error", err)
 	}
-	elog, _, _ = l.Setup("[fioetl-transform] ")
 	// initialize our search trie's for type casting. Damn those strings.
 	BuildTrie()
 }
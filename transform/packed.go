@@ -0,0 +1,197 @@
+package transform
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/ecc"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+var (
+	// chainId is needed to recover the keys that signed a transaction, recovery is skipped while it is unset.
+	chainId    []byte
+	chainIdMux sync.RWMutex
+)
+
+// SetChainId enables recovering the public keys that signed the transactions in a block, an empty id disables it.
+func SetChainId(id string) error {
+	b, err := hex.DecodeString(id)
+	if err != nil || (len(b) != 0 && len(b) != 32) {
+		return fmt.Errorf("invalid chain id %q", id)
+	}
+	chainIdMux.Lock()
+	chainId = b
+	chainIdMux.Unlock()
+	return nil
+}
+
+// UnpackedTransaction is a transaction from a block in a form that can be indexed
+type UnpackedTransaction struct {
+	Expiration         eos.JSONTime             `json:"expiration"`
+	RefBlockNum        uint16                   `json:"ref_block_num"`
+	RefBlockPrefix     uint32                   `json:"ref_block_prefix"`
+	MaxNetUsageWords   uint32                   `json:"max_net_usage_words"`
+	MaxCpuUsageMs      uint8                    `json:"max_cpu_usage_ms"`
+	DelaySec           uint32                   `json:"delay_sec"`
+	ContextFreeActions []map[string]interface{} `json:"context_free_actions"`
+	Actions            []map[string]interface{} `json:"actions"`
+	ContextFreeData    []string                 `json:"context_free_data"`
+	SigningKeys        []string                 `json:"signing_keys,omitempty"`
+}
+
+// unpackTrx replaces the trx of a block's transaction receipt with the decoded transaction. Chronicle presents it
+// either as a transaction id, for deferred transactions, or as a packed transaction, possibly wrapped in a variant.
+// The signatures stay where chronicle put them, next to the unpacked transaction.
+func unpackTrx(receipt map[string]interface{}, block uint32) {
+	trx := receipt["trx"]
+	if variant, ok := trx.([]interface{}); ok && len(variant) == 2 {
+		trx = variant[1]
+	}
+	switch t := trx.(type) {
+	case string:
+		out := map[string]interface{}{"bytes": t}
+		// a transaction id is 32 bytes, anything longer is the transaction itself
+		if len(t) > 64 {
+			if unpacked, err := unpackTransaction(t, "none", "", make([]string, 0), block); err == nil {
+				out["transaction"] = unpacked
+			}
+		}
+		receipt["trx"] = out
+	case map[string]interface{}:
+		packed, _ := t["packed_trx"].(string)
+		if packed == "" {
+			return
+		}
+		compression, _ := t["compression"].(string)
+		cfd, _ := t["packed_context_free_data"].(string)
+		sigs := make([]string, 0)
+		if s, ok := t["signatures"].([]interface{}); ok {
+			for _, sig := range s {
+				if str, ok := sig.(string); ok {
+					sigs = append(sigs, str)
+				}
+			}
+		}
+		unpacked, err := unpackTransaction(packed, compression, cfd, sigs, block)
+		if err != nil {
+			log.Warn("could not unpack transaction", "block_num", block, "error", err)
+			return
+		}
+		t["transaction"] = unpacked
+		delete(t, "packed_trx")
+		receipt["trx"] = t
+	}
+}
+
+// unpackTransaction decodes a packed transaction, action data is decoded with the ABI in force at block
+func unpackTransaction(packed string, compression string, packedCfd string, signatures []string, block uint32) (*UnpackedTransaction, error) {
+	raw, err := unpackBytes(packed, compression)
+	if err != nil {
+		return nil, fmt.Errorf("packed_trx: %v", err)
+	}
+	tx := &eos.Transaction{}
+	decoder := eos.NewDecoder(raw)
+	decoder.DecodeActions(false)
+	if err = decoder.Decode(tx); err != nil {
+		return nil, fmt.Errorf("decoding transaction: %v", err)
+	}
+	rawCfd, err := unpackBytes(packedCfd, compression)
+	if err != nil {
+		return nil, fmt.Errorf("packed_context_free_data: %v", err)
+	}
+
+	u := &UnpackedTransaction{
+		Expiration:         tx.Expiration,
+		RefBlockNum:        tx.RefBlockNum,
+		RefBlockPrefix:     tx.RefBlockPrefix,
+		MaxNetUsageWords:   uint32(tx.MaxNetUsageWords),
+		MaxCpuUsageMs:      tx.MaxCPUUsageMS,
+		DelaySec:           uint32(tx.DelaySec),
+		ContextFreeActions: unpackActions(tx.ContextFreeActions, block),
+		Actions:            unpackActions(tx.Actions, block),
+		ContextFreeData:    make([]string, 0),
+	}
+	if len(rawCfd) > 0 {
+		cfd := make([]eos.HexBytes, 0)
+		if err = eos.NewDecoder(rawCfd).Decode(&cfd); err != nil {
+			return nil, fmt.Errorf("decoding context free data: %v", err)
+		}
+		for _, d := range cfd {
+			u.ContextFreeData = append(u.ContextFreeData, hex.EncodeToString(d))
+		}
+	}
+
+	chainIdMux.RLock()
+	id := chainId
+	chainIdMux.RUnlock()
+	if len(id) > 0 {
+		// the digest is taken over the bytes as they were signed, re-encoding the transaction could change them
+		digest := eos.SigDigest(id, raw, rawCfd)
+		for _, s := range signatures {
+			// the transaction is still worth indexing without its keys
+			sig, err := ecc.NewSignature(s)
+			if err != nil {
+				log.Warn("could not parse signature", "block_num", block, "signature", s, "error", err)
+				continue
+			}
+			pub, err := sig.PublicKey(digest)
+			if err != nil {
+				log.Warn("could not recover signing key", "block_num", block, "signature", s, "error", err)
+				continue
+			}
+			u.SigningKeys = append(u.SigningKeys, pub.String())
+		}
+	}
+	return u, nil
+}
+
+// unpackActions decodes and casts action data the same way as for traces
+func unpackActions(actions []*eos.Action, block uint32) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(actions))
+	for _, a := range actions {
+		auth := make([]map[string]interface{}, 0, len(a.Authorization))
+		for _, p := range a.Authorization {
+			auth = append(auth, map[string]interface{}{"actor": string(p.Actor), "permission": string(p.Permission)})
+		}
+		act := map[string]interface{}{
+			"account":       string(a.Account),
+			"name":          string(a.Name),
+			"authorization": auth,
+		}
+		data, err := abis.decodeAction(string(a.Account), string(a.Name), a.HexData, block)
+		if err == nil {
+			act["data"] = data
+			act["decoded_by"] = "fioetl"
+		} else {
+			act["data"] = map[string]interface{}{"raw": hex.EncodeToString(a.HexData)}
+		}
+		fixupAction(string(a.Account), string(a.Name), act["data"], "data", block)
+		out = append(out, Fixup(act))
+	}
+	return out
+}
+
+func unpackBytes(s string, compression string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return b, err
+	}
+	switch strings.ToLower(compression) {
+	case "", "0", "none":
+		return b, nil
+	case "1", "zlib":
+		r, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, errors.New("unknown compression " + compression)
+}
@@ -0,0 +1,97 @@
+package transform
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/ecc"
+)
+
+func TestUnpackTrx(t *testing.T) {
+	data, err := abis.at("fio.token", 0).EncodeAction(eos.ActionName("trnsfiopubky"), []byte(
+		`{"payee_public_key":"FIO6G9pXXM92Gy5eMwNquGULoCj3ZStwPLPdEb9mVXyEHqWN7HSuA","amount":1000000000,"max_fee":400000000,"actor":"aloha","tpid":""}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &eos.Transaction{
+		TransactionHeader: eos.TransactionHeader{
+			Expiration:     eos.JSONTime{Time: time.Date(2020, 3, 25, 12, 0, 0, 0, time.UTC)},
+			RefBlockNum:    1234,
+			RefBlockPrefix: 5678,
+		},
+		Actions: []*eos.Action{{
+			Account:       "fio.token",
+			Name:          "trnsfiopubky",
+			Authorization: []eos.PermissionLevel{{Actor: "aloha", Permission: "active"}},
+			ActionData:    eos.ActionData{HexData: data},
+		}},
+	}
+	raw, err := eos.MarshalBinary(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecc.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "21dcae42c0182200e93f954a074011f9048a7624c6fe81d3c9541a614a88bd1c"
+	chain, _ := hex.DecodeString(id)
+	sig, err := key.Sign(eos.SigDigest(chain, raw, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SetChainId(id); err != nil {
+		t.Fatal(err)
+	}
+	defer SetChainId("")
+
+	compressed := &bytes.Buffer{}
+	z := zlib.NewWriter(compressed)
+	_, _ = z.Write(raw)
+	_ = z.Close()
+	receipt := map[string]interface{}{
+		"status": "executed",
+		"trx": []interface{}{"packed_transaction", map[string]interface{}{
+			"signatures":               []interface{}{"SIG_K1_notasignature", sig.String()},
+			"compression":              "zlib",
+			"packed_context_free_data": "",
+			"packed_trx":               hex.EncodeToString(compressed.Bytes()),
+		}},
+	}
+	unpackTrx(receipt, 100)
+	trx, ok := receipt["trx"].(map[string]interface{})["transaction"].(*UnpackedTransaction)
+	if !ok {
+		t.Fatalf("transaction was not unpacked: %v", receipt["trx"])
+	}
+	if trx.RefBlockNum != 1234 || trx.RefBlockPrefix != 5678 || !trx.Expiration.Time.Equal(tx.Expiration.Time) {
+		t.Errorf("unexpected header %+v", trx)
+	}
+	if len(trx.Actions) != 1 || trx.Actions[0]["decoded_by"] != "fioetl" {
+		t.Fatalf("expected a decoded action, got %v", trx.Actions)
+	}
+	act := trx.Actions[0]
+	if act["data"].(map[string]interface{})["amount"] != int64(1000000000) {
+		t.Errorf("expected amount cast to an integer, got %#v", act["data"])
+	}
+	if act["authorization"].([]map[string]interface{})[0]["actor"] != "aloha" {
+		t.Errorf("unexpected authorization %v", act["authorization"])
+	}
+	if len(trx.SigningKeys) != 1 || trx.SigningKeys[0] != key.PublicKey().String() || trx.SigningKeys[0][:3] != "FIO" {
+		t.Errorf("expected signing key %s, got %v", key.PublicKey().String(), trx.SigningKeys)
+	}
+	if sigs := receipt["trx"].(map[string]interface{})["signatures"].([]interface{}); len(sigs) != 2 {
+		t.Errorf("expected the signatures to be kept, got %v", sigs)
+	}
+
+	// deferred transactions only have an id
+	receipt = map[string]interface{}{"trx": []interface{}{"transaction_id", "0f4d1ee8e7fbbcd34e8d4d2dc7f4f3fd7b0d05d11a4b78f4a9a8cd7e7bf7f3b2"}}
+	unpackTrx(receipt, 100)
+	if _, ok := receipt["trx"].(map[string]interface{})["transaction"]; ok {
+		t.Error("a transaction id should not be unpacked")
+	}
+}
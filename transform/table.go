@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -27,14 +28,23 @@ type Kvo struct {
 	Value          interface{} `json:"value"`
 }
 
-func (k *Kvo) fixTable() {
+func (k *Kvo) fixTable(block uint32) {
 	// see if there was an abi error, and attempt to deal with it
 	switch k.Value.(type) {
 	case string, []byte:
 		if s, ok := k.Value.(string); ok {
-			k.Value = abis.lookup(k.Code, k.Table, s)
+			k.Value = abis.lookup(k.Code, k.Table, s, block)
 		}
 	}
+	if raw, ok := k.Value.(json.RawMessage); ok && len(raw) > 0 && raw[0] == '{' {
+		row := make(map[string]interface{})
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if dec.Decode(&row) == nil {
+			k.Value = numbersToStrings(row)
+		}
+	}
+	fixupRow(k.Code, k.Table, k.Value, "kvo.value", block)
 
 	// see if key is an integer value, and try to derive a name if appropriate
 	i, err := strconv.ParseUint(k.PrimaryKey.(string), 10, 64)
@@ -59,12 +69,17 @@ func Table(b []byte) (j json.RawMessage, err error) {
 	if err != nil || td.Kvo == nil {
 		return
 	}
-	td.Kvo.fixTable()
+	bn, _ := strconv.ParseUint(td.BlockNum.(string), 10, 32)
+	td.BlockNum = bn
+	td.Kvo.fixTable(uint32(bn))
+	if row, ok := td.Kvo.Value.(map[string]interface{}); ok {
+		// the static lists still apply to rows, the token balances are indexed as floats rather than asset objects
+		Fixup(map[string]interface{}{"kvo": map[string]interface{}{"value": row}})
+	}
 	h := sha256.New()
 	h.Write(b)
 	td.Id = hex.EncodeToString(h.Sum(nil))
 	td.RecordType = "table_row"
-	td.BlockNum, _ = strconv.ParseUint(td.BlockNum.(string), 10, 32)
 	j, err = json.Marshal(td)
 	return j, err
 }
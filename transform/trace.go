@@ -1,9 +1,8 @@
 package transform
 
 import (
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"log"
 	"strconv"
 )
 
@@ -41,41 +40,51 @@ func Trace(b []byte) (trace json.RawMessage, err error) {
 	tr := &TraceResult{}
 	err = json.Unmarshal(msg.Data, tr)
 	if err != nil {
-		log.Println("issue decoding trace:")
-		fmt.Println(string(msg.Data))
 		msi := make(map[string]interface{})
-		err = json.Unmarshal(msg.Data, &msi)
-		if err != nil {
-			log.Println(err)
+		if json.Unmarshal(msg.Data, &msi) != nil {
+			log.Error("could not decode trace", "error", err, "data", msg.Data)
 			return
 		}
-		if msi["trace"] != nil {
-			switch msi["trace"].(type) {
-			case string:
-				log.Println("entire trace was a string!")
-			}
+		if _, ok := msi["trace"].(string); ok {
+			log.Error("entire trace was a string", "error", err, "data", msg.Data)
+			return
 		}
+		log.Error("could not decode trace", "error", err, "block_num", msi["block_num"])
 		return
 	}
 	tr.Id = tr.Trace.Id
-	tr.BlockNum, _ = strconv.ParseUint(tr.BlockNum.(string), 10, 32)
+	bn, _ := strconv.ParseUint(tr.BlockNum.(string), 10, 32)
+	tr.BlockNum = bn
 	tr.RecordType = "trace"
 	for _, t := range tr.Trace.ActionTraces {
-		// act.data and act.data.owner both can present as a string, maybe it's an ABI problem?
-		// but it violates elasticsearch's schema and they won't get indexed if not a struct:
-		switch t["act"].(type) {
-		case map[string]interface{}:
-			switch t["act"].(map[string]interface{})["data"].(type) {
-			case string:
-				t["act"].(map[string]interface{})["data"] = map[string]interface{}{"raw": t["act"].(map[string]interface{})["data"].(string)}
-			case map[string]interface{}:
-				switch t["act"].(map[string]interface{})["data"].(map[string]interface{})["owner"].(type) {
-				case string:
-					t["act"].(map[string]interface{})["data"].(map[string]interface{})["owner"] = map[string]interface{}{"data": t["act"].(map[string]interface{})["data"].(map[string]interface{})["owner"].(string)}
+		if act, ok := t["act"].(map[string]interface{}); ok {
+			account, _ := act["account"].(string)
+			name, _ := act["name"].(string)
+			// chronicle sends act.data as hex when it couldn't decode it, which violates elasticsearch's schema
+			// and isn't searchable, so try again with the ABI in force at the block and only keep it raw as a last resort.
+			if s, ok := act["data"].(string); ok {
+				b, err := hex.DecodeString(s)
+				var data map[string]interface{}
+				if err == nil {
+					data, err = abis.decodeAction(account, name, b, uint32(bn))
+				}
+				if err == nil {
+					act["data"] = data
+					act["decoded_by"] = "fioetl"
+				} else {
+					log.Debug("could not decode action", "block_num", bn, "account", account, "action", name, "error", err)
+					act["data"] = map[string]interface{}{"raw": s}
+				}
+			}
+			fixupAction(account, name, act["data"], "act.data", uint32(bn))
+			// act.data.owner can also present as a string
+			if data, ok := act["data"].(map[string]interface{}); ok {
+				if owner, ok := data["owner"].(string); ok {
+					data["owner"] = map[string]interface{}{"data": owner}
 				}
 			}
 		}
-		// trie-search and replace for integer and float casts
+		// trie-search and replace for the casts that override the ABI
 		t = Fixup(t)
 	}
 	return json.Marshal(tr)
@@ -0,0 +1,44 @@
+package transform
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/fioprotocol/fio-go/eos"
+)
+
+func TestTraceDecodesHexData(t *testing.T) {
+	b, err := abis.at("fio.token", 0).EncodeAction(eos.ActionName("trnsfiopubky"), []byte(
+		`{"payee_public_key":"FIO6G9pXXM92Gy5eMwNquGULoCj3ZStwPLPdEb9mVXyEHqWN7HSuA","amount":1000000000,"max_fee":400000000,"actor":"aloha","tpid":""}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := func(data string) map[string]interface{} {
+		j, err := Trace([]byte(`{"msgtype":"TX_TRACE","data":{"block_num":"100","block_timestamp":"2020-03-25T12:00:00.000",
+"trace":{"id":"abc","status":"executed","action_traces":[{"act":{"account":"fio.token","name":"trnsfiopubky","data":"` + data + `"}}]}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := &TraceResult{}
+		if err = json.Unmarshal(j, tr); err != nil {
+			t.Fatal(err)
+		}
+		return tr.Trace.ActionTraces[0]["act"].(map[string]interface{})
+	}
+
+	act := trace(hex.EncodeToString(b))
+	if act["decoded_by"] != "fioetl" {
+		t.Error("expected decoded_by to be set")
+	}
+	data := act["data"].(map[string]interface{})
+	if data["actor"] != "aloha" || data["amount"] != float64(1000000000) {
+		t.Errorf("unexpected decoded data %v", data)
+	}
+
+	act = trace("not hex")
+	if act["decoded_by"] != nil || act["data"].(map[string]interface{})["raw"] != "not hex" {
+		t.Errorf("undecodable data should be kept raw, got %v", act)
+	}
+}
@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Transfer is a single transfer action split out of a trace, this makes it easier to find fees and reward payouts.
+type Transfer struct {
+	Id         string                 `json:"id"`
+	RecordType string                 `json:"record_type"`
+	BlockNum   interface{}            `json:"block_num"`
+	BlockTime  string                 `json:"block_timestamp"`
+	TxId       string                 `json:"txid"`
+	Action     map[string]interface{} `json:"action"`
+	Partner    string                 `json:"partner,omitempty"`
+}
+
+// Transfers builds a record for each transfer action in a trace produced by Trace. The id is the transaction id with
+// the action ordinal appended, and partner is the tpid of the first action in the transaction.
+func Transfers(trace json.RawMessage) (transfers []json.RawMessage, err error) {
+	tr := &TraceResult{}
+	dec := json.NewDecoder(bytes.NewReader(trace))
+	// don't lose precision on large integers like global_sequence
+	dec.UseNumber()
+	err = dec.Decode(tr)
+	if err != nil {
+		return
+	}
+	var partner string
+	if len(tr.Trace.ActionTraces) > 0 {
+		if act, ok := tr.Trace.ActionTraces[0]["act"].(map[string]interface{}); ok {
+			if data, ok := act["data"].(map[string]interface{}); ok {
+				partner, _ = data["tpid"].(string)
+			}
+		}
+	}
+	transfers = make([]json.RawMessage, 0)
+	for _, action := range tr.Trace.ActionTraces {
+		if act, ok := action["act"].(map[string]interface{}); !ok || act["name"] != "transfer" {
+			continue
+		}
+		var t json.RawMessage
+		t, err = json.Marshal(&Transfer{
+			Id:         fmt.Sprintf("%s-%v", tr.Id, action["action_ordinal"]),
+			RecordType: "transfer",
+			BlockNum:   tr.BlockNum,
+			BlockTime:  tr.BlockTime,
+			TxId:       tr.Id,
+			Action:     action,
+			Partner:    partner,
+		})
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return
+}
@@ -0,0 +1,36 @@
+package transform
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTransfers(t *testing.T) {
+	tr := []byte(`{"id":"abc","record_type":"trace","block_num":123,"block_timestamp":"2020-07-07T03:57:22.500",
+		"trace":{"id":"abc","action_traces":[
+			{"action_ordinal":1,"act":{"name":"trnsfiopubky","data":{"tpid":"rewards@wallet"}}},
+			{"action_ordinal":2,"receipt":{"global_sequence":18446744073709551615},"act":{"name":"transfer","data":{"quantity":40}}},
+			{"action_ordinal":3,"act":{"name":"transfer","data":{"quantity":2}}}
+		]}}`)
+	transfers, err := Transfers(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 2 {
+		t.Fatalf("expected 2 transfers, got %d", len(transfers))
+	}
+	if !strings.Contains(string(transfers[0]), `"global_sequence":18446744073709551615`) {
+		t.Error("lost precision on global_sequence:", string(transfers[0]))
+	}
+	xfer := &Transfer{}
+	if err = json.Unmarshal(transfers[1], xfer); err != nil {
+		t.Fatal(err)
+	}
+	if xfer.Id != "abc-3" || xfer.TxId != "abc" || xfer.Partner != "rewards@wallet" || xfer.RecordType != "transfer" {
+		t.Errorf("unexpected transfer: %+v", xfer)
+	}
+	if xfer.BlockNum.(float64) != 123 || xfer.BlockTime != "2020-07-07T03:57:22.500" {
+		t.Errorf("block metadata not copied: %+v", xfer)
+	}
+}